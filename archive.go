@@ -0,0 +1,463 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package yap
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/qiniu/x/http/fsx"
+)
+
+// Archive returns a file system of a .zip, .tar, .tar.gz or .tgz file, eg.
+// `app.Static("/", app.Archive("dist.zip"))`. The file is opened from disk
+// if it exists, otherwise from $YapFS. It's closed when the engine shuts
+// down.
+func (p *Engine) Archive(name string) fs.FS {
+	a, err := p.openArchive(name)
+	if err != nil {
+		log.Panicln("Archive:", err)
+	}
+	p.OnShutdown(func() { a.Close() })
+	return a
+}
+
+// openArchive opens the archive name from disk if it exists, otherwise from
+// $YapFS.
+func (p *Engine) openArchive(name string) (*ArchiveFS, error) {
+	if _, err := os.Stat(name); err == nil {
+		return openArchive(func() (fs.File, error) { return os.Open(name) }, name)
+	}
+	return OpenArchive(p.yapFS(), name)
+}
+
+func (p *Engine) staticArchive(pattern, url string) (fsx.Closer, error) {
+	a, err := p.openArchive(url)
+	if err != nil {
+		return nil, err
+	}
+	p.StaticHttp(pattern, http.FS(a), false)
+	return a.Close, nil
+}
+
+// MaxArchiveEntrySize is the max size of a file in a tar archive. Opening an
+// archive that contains a larger file fails.
+var MaxArchiveEntrySize int64 = 1 << 30
+
+// ArchiveFS is a read-only file system of a zip or tar archive. Entries of
+// the archive are indexed once when it's opened. Stored files of a zip
+// archive, and files of a tar archive that supports random access, are read
+// from the archive directly. Compressed files of a zip archive are
+// decompressed as they are read. Files of a compressed tar archive are
+// decompressed once to a temporary file when the archive is opened.
+type ArchiveFS struct {
+	fs.FS
+	closer io.Closer
+}
+
+// Close closes the archive file.
+func (p *ArchiveFS) Close() error {
+	if p.closer != nil {
+		return p.closer.Close()
+	}
+	return nil
+}
+
+// OpenArchive opens the .zip, .tar, .tar.gz or .tgz file name of fsys as a
+// file system.
+func OpenArchive(fsys fs.FS, name string) (*ArchiveFS, error) {
+	return openArchive(func() (fs.File, error) { return fsys.Open(name) }, name)
+}
+
+func isArchive(name string) bool {
+	return archiveKind(name) != ""
+}
+
+func archiveKind(name string) string {
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return "zip"
+	case strings.HasSuffix(name, ".tar"):
+		return "tar"
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return "tgz"
+	}
+	return ""
+}
+
+func openArchive(open func() (fs.File, error), name string) (ret *ArchiveFS, err error) {
+	kind := archiveKind(name)
+	if kind == "" {
+		return nil, &fs.PathError{Op: "open archive", Path: name, Err: fs.ErrInvalid}
+	}
+	f, err := open()
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			if f != nil {
+				f.Close()
+			}
+			err = &fs.PathError{Op: "open archive", Path: name, Err: err}
+		}
+	}()
+	fi, err := f.Stat()
+	if err != nil {
+		return
+	}
+	if kind == "tgz" {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		tmp, err := newTempFile()
+		if err != nil {
+			return nil, err
+		}
+		t, err := newTarFS(zr, fi.ModTime(), tmp.File)
+		if err != nil {
+			tmp.Close()
+			return nil, err
+		}
+		f.Close()
+		return &ArchiveFS{FS: t, closer: tmp}, nil
+	}
+	ra, ok := f.(io.ReaderAt)
+	if !ok { // read the archive into memory
+		b, err := io.ReadAll(f)
+		if err != nil {
+			return nil, err
+		}
+		f.Close()
+		f, ra = nil, bytes.NewReader(b)
+	}
+	var fsys fs.FS
+	if kind == "zip" {
+		fsys, err = newZipFS(ra, fi.Size())
+	} else {
+		fsys, err = newTarFS(io.NewSectionReader(ra, 0, fi.Size()), fi.ModTime(), nil)
+	}
+	if err != nil {
+		return
+	}
+	ret = &ArchiveFS{FS: fsys}
+	if f != nil {
+		ret.closer = f
+	}
+	return
+}
+
+// -----------------------------------------------------------------------------
+
+// archiveFile is a file of an archive that supports random access.
+type archiveFile struct {
+	*io.SectionReader
+	fi fs.FileInfo
+}
+
+func (p *archiveFile) Stat() (fs.FileInfo, error) { return p.fi, nil }
+func (p *archiveFile) Close() error               { return nil }
+
+// tempFile is a temporary file which is removed when it's closed.
+type tempFile struct {
+	*os.File
+}
+
+func newTempFile() (*tempFile, error) {
+	f, err := os.CreateTemp("", "yap-archive-*")
+	if err != nil {
+		return nil, err
+	}
+	os.Remove(f.Name()) // unlink it now where an open file can be removed
+	return &tempFile{f}, nil
+}
+
+func (p *tempFile) Close() error {
+	err := p.File.Close()
+	os.Remove(p.Name())
+	return err
+}
+
+type zipFS struct {
+	*zip.Reader
+	ra    io.ReaderAt
+	files map[string]*zip.File
+}
+
+func newZipFS(ra io.ReaderAt, size int64) (*zipFS, error) {
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[path.Clean(strings.TrimPrefix(f.Name, "/"))] = f
+	}
+	return &zipFS{zr, ra, files}, nil
+}
+
+// Open opens the file name. Stored files are read from the archive directly,
+// and compressed ones are decompressed as they are read.
+func (p *zipFS) Open(name string) (fs.File, error) {
+	zf, ok := p.files[name]
+	if !ok || zf.FileInfo().IsDir() {
+		return p.Reader.Open(name)
+	}
+	fi := zf.FileInfo()
+	if zf.Method == zip.Store {
+		off, err := zf.DataOffset()
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		return &archiveFile{io.NewSectionReader(p.ra, off, int64(zf.UncompressedSize64)), fi}, nil
+	}
+	return &zipFile{zf: zf, fi: fi}, nil
+}
+
+// zipFile is a compressed file of a zip archive. Seeking is lazy: a read
+// after seeking backward decompresses the file from the start again, and a
+// read after seeking forward skips the data in between.
+type zipFile struct {
+	zf  *zip.File
+	fi  fs.FileInfo
+	rc  io.ReadCloser
+	off int64 // offset of rc
+	pos int64 // offset of the next read
+}
+
+func (p *zipFile) Stat() (fs.FileInfo, error) { return p.fi, nil }
+
+func (p *zipFile) Read(b []byte) (n int, err error) {
+	if p.pos >= p.fi.Size() {
+		return 0, io.EOF
+	}
+	if p.rc == nil || p.pos < p.off {
+		if p.rc != nil {
+			p.rc.Close()
+		}
+		if p.rc, err = p.zf.Open(); err != nil {
+			p.rc = nil
+			return
+		}
+		p.off = 0
+	}
+	if p.pos > p.off {
+		skip, err := io.CopyN(io.Discard, p.rc, p.pos-p.off)
+		p.off += skip
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err = p.rc.Read(b)
+	p.off += int64(n)
+	p.pos = p.off
+	return
+}
+
+func (p *zipFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += p.pos
+	case io.SeekEnd:
+		offset += p.fi.Size()
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: p.fi.Name(), Err: fs.ErrInvalid}
+	}
+	p.pos = offset
+	return offset, nil
+}
+
+func (p *zipFile) Close() error {
+	if p.rc != nil {
+		return p.rc.Close()
+	}
+	return nil
+}
+
+// -----------------------------------------------------------------------------
+
+type tarEntry struct {
+	name    string // base name
+	mode    fs.FileMode
+	modTime time.Time
+	size    int64
+	offset  int64 // offset of data in the tar stream, or in the spill file
+	entries []*tarEntry
+}
+
+func (p *tarEntry) Name() string               { return p.name }
+func (p *tarEntry) Size() int64                { return p.size }
+func (p *tarEntry) Mode() fs.FileMode          { return p.mode }
+func (p *tarEntry) ModTime() time.Time         { return p.modTime }
+func (p *tarEntry) IsDir() bool                { return p.mode.IsDir() }
+func (p *tarEntry) Sys() any                   { return nil }
+func (p *tarEntry) Type() fs.FileMode          { return p.mode.Type() }
+func (p *tarEntry) Info() (fs.FileInfo, error) { return p, nil }
+
+type tarFS struct {
+	ra      io.ReaderAt          // of the tar stream, or of the spill file
+	entries map[string]*tarEntry // path => entry
+}
+
+// newTarFS indexes entries of the tar stream r. If spill isn't nil, r doesn't
+// support random access (eg. a decompressed stream), and data of files are
+// copied to spill to be read from there.
+func newTarFS(r io.Reader, modTime time.Time, spill *os.File) (*tarFS, error) {
+	p := &tarFS{entries: make(map[string]*tarEntry)}
+	var spilled int64
+	if spill != nil {
+		p.ra = spill
+	} else {
+		p.ra = r.(io.ReaderAt)
+	}
+	p.entries["."] = &tarEntry{name: ".", mode: fs.ModeDir | 0555, modTime: modTime}
+	cr := &countingReader{r: r}
+	tr := tar.NewReader(cr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := path.Clean(strings.TrimPrefix(hdr.Name, "/"))
+		if !fs.ValidPath(name) || name == "." {
+			continue
+		}
+		var e *tarEntry
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			e = p.dir(name, hdr.ModTime)
+			e.modTime = hdr.ModTime
+			continue
+		case tar.TypeReg:
+			if hdr.Size > MaxArchiveEntrySize {
+				return nil, fmt.Errorf("yap: archive entry %s is too large (%d bytes)", name, hdr.Size)
+			}
+			e = &tarEntry{
+				name: path.Base(name), mode: hdr.FileInfo().Mode(), modTime: hdr.ModTime,
+				size: hdr.Size, offset: cr.n,
+			}
+			if spill != nil {
+				e.offset = spilled
+				n, err := io.CopyN(spill, tr, hdr.Size)
+				spilled += n
+				if err != nil {
+					return nil, err
+				}
+			}
+		default: // links, devices, etc. aren't supported
+			continue
+		}
+		parent := p.dir(path.Dir(name), modTime)
+		if _, ok := p.entries[name]; !ok {
+			parent.entries = append(parent.entries, e)
+		} else {
+			for j, old := range parent.entries {
+				if old.name == e.name {
+					parent.entries[j] = e
+				}
+			}
+		}
+		p.entries[name] = e
+	}
+	for _, e := range p.entries {
+		sort.Slice(e.entries, func(i, j int) bool { return e.entries[i].name < e.entries[j].name })
+	}
+	return p, nil
+}
+
+// dir returns the directory entry name, creates it and its parents if they
+// don't exist.
+func (p *tarFS) dir(name string, modTime time.Time) *tarEntry {
+	if e, ok := p.entries[name]; ok {
+		return e
+	}
+	e := &tarEntry{name: path.Base(name), mode: fs.ModeDir | 0555, modTime: modTime}
+	parent := p.dir(path.Dir(name), modTime)
+	parent.entries = append(parent.entries, e)
+	p.entries[name] = e
+	return e
+}
+
+func (p *tarFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	e, ok := p.entries[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if e.IsDir() {
+		return &tarDir{e: e}, nil
+	}
+	return &archiveFile{io.NewSectionReader(p.ra, e.offset, e.size), e}, nil
+}
+
+type tarDir struct {
+	e   *tarEntry
+	pos int
+}
+
+func (p *tarDir) Stat() (fs.FileInfo, error) { return p.e, nil }
+func (p *tarDir) Close() error               { return nil }
+
+func (p *tarDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: p.e.name, Err: fs.ErrInvalid}
+}
+
+func (p *tarDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := p.e.entries[p.pos:]
+	if n > 0 && len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > 0 && n < len(rest) {
+		rest = rest[:n]
+	}
+	p.pos += len(rest)
+	ret := make([]fs.DirEntry, len(rest))
+	for i, e := range rest {
+		ret[i] = e
+	}
+	return ret, nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (p *countingReader) Read(b []byte) (n int, err error) {
+	n, err = p.r.Read(b)
+	p.n += int64(n)
+	return
+}
@@ -0,0 +1,189 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package yap
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+var archiveFiles = []struct {
+	name, data string
+	method     uint16
+}{
+	{"index.html", "<app>", zip.Deflate},
+	{"js/app.js", "console.log(1)", zip.Store},
+}
+
+func makeZip(modTime time.Time) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range archiveFiles {
+		w, _ := zw.CreateHeader(&zip.FileHeader{Name: f.name, Method: f.method, Modified: modTime})
+		w.Write([]byte(f.data))
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+func makeTar(modTime time.Time, compress bool) []byte {
+	var buf bytes.Buffer
+	var gw *gzip.Writer
+	tw := tar.NewWriter(&buf)
+	if compress {
+		gw = gzip.NewWriter(&buf)
+		tw = tar.NewWriter(gw)
+	}
+	tw.WriteHeader(&tar.Header{Name: "js/", Typeflag: tar.TypeDir, Mode: 0755, ModTime: modTime})
+	for _, f := range archiveFiles {
+		tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.data)), ModTime: modTime})
+		tw.Write([]byte(f.data))
+	}
+	tw.Close()
+	if gw != nil {
+		gw.Close()
+	}
+	return buf.Bytes()
+}
+
+func TestArchive(t *testing.T) {
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	dir := t.TempDir()
+	disk := filepath.Join(dir, "dist.tar")
+	if err := os.WriteFile(disk, makeTar(modTime, false), 0644); err != nil {
+		t.Fatal(err)
+	}
+	e := New(fstest.MapFS{
+		"dist.zip":    {Data: makeZip(modTime)},
+		"dist.tar.gz": {Data: makeTar(modTime, true)},
+	})
+	e.Static("/zip", e.Archive("dist.zip"))
+	e.Static("/tgz", e.Archive("dist.tar.gz"))
+	e.Static("/tar", e.Archive(disk))
+
+	for _, prefix := range []string{"/zip", "/tgz", "/tar"} {
+		for _, f := range archiveFiles[1:] { // index.html is redirected to ./
+			w := httptest.NewRecorder()
+			e.ServeHTTP(w, httptest.NewRequest("GET", prefix+"/"+f.name, nil))
+			if w.Code != 200 || w.Body.String() != f.data || w.Header().Get("Last-Modified") != modTime.Format(http.TimeFormat) {
+				t.Fatal(prefix, f.name, w.Code, w.Body.String(), w.Header())
+			}
+		}
+		req := httptest.NewRequest("GET", prefix+"/js/app.js", nil)
+		req.Header.Set("If-Modified-Since", modTime.Format(http.TimeFormat))
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, req)
+		if w.Code != 304 {
+			t.Fatal(prefix, "If-Modified-Since:", w.Code)
+		}
+		req = httptest.NewRequest("GET", prefix+"/js/app.js", nil)
+		req.Header.Set("Range", "bytes=0-6")
+		w = httptest.NewRecorder()
+		e.ServeHTTP(w, req)
+		if w.Code != 206 || w.Body.String() != "console" {
+			t.Fatal(prefix, "Range:", w.Code, w.Body.String())
+		}
+		w = httptest.NewRecorder()
+		e.ServeHTTP(w, httptest.NewRequest("GET", prefix+"/", nil))
+		if w.Code != 200 || w.Body.String() != "<app>" {
+			t.Fatal(prefix, "index:", w.Code, w.Body.String())
+		}
+	}
+}
+
+type countFS struct {
+	fs.FS
+	opens int
+}
+
+func (p *countFS) Open(name string) (fs.File, error) {
+	p.opens++
+	return p.FS.Open(name)
+}
+
+func TestArchiveReopen(t *testing.T) {
+	fsys := &countFS{FS: fstest.MapFS{
+		"dist.zip":    {Data: makeZip(time.Time{})},
+		"dist.tar.gz": {Data: makeTar(time.Time{}, true)},
+	}}
+	for _, name := range []string{"dist.zip", "dist.tar.gz"} {
+		a, err := OpenArchive(fsys, name)
+		if err != nil {
+			t.Fatal("OpenArchive:", name, err)
+		}
+		opens := fsys.opens
+		for i := 0; i < 2; i++ {
+			for _, f := range archiveFiles {
+				if b, err := fs.ReadFile(a, f.name); err != nil || string(b) != f.data {
+					t.Fatal("ReadFile:", name, f.name, string(b), err)
+				}
+			}
+		}
+		if fsys.opens != opens {
+			t.Fatal("archive is reopened:", name, fsys.opens-opens)
+		}
+		a.Close()
+	}
+
+	a, _ := OpenArchive(fsys, "dist.zip")
+	f, err := a.Open("index.html") // compressed
+	if err != nil {
+		t.Fatal("Open:", err)
+	}
+	defer f.Close()
+	rs := f.(io.ReadSeeker)
+	for _, c := range []struct {
+		off  int64
+		want string
+	}{{1, "app>"}, {3, "p>"}, {0, "<app>"}, {-1, ">"}} {
+		whence := io.SeekStart
+		if c.off < 0 {
+			whence = io.SeekEnd
+		}
+		rs.Seek(c.off, whence)
+		if b, err := io.ReadAll(rs); err != nil || string(b) != c.want {
+			t.Fatal("Seek:", c.off, string(b), err)
+		}
+	}
+}
+
+func TestArchiveEntryTooLarge(t *testing.T) {
+	max := MaxArchiveEntrySize
+	MaxArchiveEntrySize = 4
+	defer func() { MaxArchiveEntrySize = max }()
+	fsys := fstest.MapFS{
+		"dist.tar.gz": {Data: makeTar(time.Time{}, true)},
+		"dist.tar":    {Data: makeTar(time.Time{}, false)},
+	}
+	for _, name := range []string{"dist.tar.gz", "dist.tar"} {
+		if _, err := OpenArchive(fsys, name); err == nil || !strings.Contains(err.Error(), "too large") {
+			t.Fatal("OpenArchive:", name, err)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package yap
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	assetHashLen = 10
+
+	// assetCacheControl is the Cache-Control of fingerprinted assets, which
+	// never change.
+	assetCacheControl = "public, max-age=31536000, immutable"
+)
+
+// Assets serves static files from a dir (default is "$YapFS/static") like
+// Static, and fingerprints them by their content. A file can be requested by
+// its fingerprinted URL, eg. /static/app.3f2a9c1d0b.css for app.css, which is
+// served with `Cache-Control: immutable` and a long max-age. Templates refer
+// to fingerprinted URLs by the asset function, and to Subresource Integrity
+// hashes by the integrity function:
+//
+//	<link rel="stylesheet" href="{{asset "app.css"}}" integrity="{{integrity "app.css"}}">
+//
+// Assets can be called with different patterns, eg. for app and vendor files.
+// The functions look up a name in their dirs in the order they are added. In
+// debug mode, fingerprints are updated when files change.
+func (p *Engine) Assets(pattern string, dir ...fs.FS) {
+	var fsys fs.FS
+	if dir != nil {
+		fsys = dir[0]
+	} else {
+		fsys = p.FS("static")
+	}
+	if !strings.HasSuffix(pattern, "/") {
+		pattern += "/"
+	}
+	m, err := newAssetManifest(pattern, fsys)
+	if err != nil {
+		log.Panicln("Assets:", err)
+	}
+	p.assets = append(p.assets, m)
+	p.Mux.Handle(pattern, http.StripPrefix(pattern, m))
+}
+
+// AssetURL returns the fingerprinted URL of the static file name. It returns
+// the plain URL if name isn't found. See Assets.
+func (p *Engine) AssetURL(name string) string {
+	m, e := p.lookupAsset(name)
+	if m == nil {
+		return name
+	}
+	if e == nil {
+		return m.prefix + strings.TrimPrefix(name, "/")
+	}
+	return m.prefix + e.hashed
+}
+
+// AssetIntegrity returns the Subresource Integrity hash (sha384) of the static
+// file name, or "" if name isn't found. See Assets.
+func (p *Engine) AssetIntegrity(name string) string {
+	if _, e := p.lookupAsset(name); e != nil {
+		return e.integrity
+	}
+	return ""
+}
+
+// lookupAsset returns the first manifest which has the file name, and its
+// entry. If name isn't found, it returns the first manifest and a nil entry.
+func (p *Engine) lookupAsset(name string) (*assetManifest, *assetEntry) {
+	for _, m := range p.assets {
+		if e := m.lookup(name); e != nil {
+			return m, e
+		}
+	}
+	if p.assets == nil {
+		return nil, nil
+	}
+	return p.assets[0], nil
+}
+
+// -----------------------------------------------------------------------------
+
+// assetEntry is a fingerprinted file. It's immutable, and replaced by a new
+// one when the file changes.
+type assetEntry struct {
+	hashed    string // fingerprinted name
+	modTime   time.Time
+	size      int64
+	integrity string
+}
+
+type assetManifest struct {
+	prefix  string
+	fsys    fs.FS
+	server  http.Handler
+	mutex   sync.RWMutex
+	entries map[string]*assetEntry // name => entry
+	names   map[string]string      // fingerprinted name => name
+}
+
+func newAssetManifest(prefix string, fsys fs.FS) (*assetManifest, error) {
+	m := &assetManifest{
+		prefix:  prefix,
+		fsys:    fsys,
+		server:  http.FileServer(http.FS(fsys)),
+		entries: make(map[string]*assetEntry),
+		names:   make(map[string]string),
+	}
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return m.add(name, fi)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// add fingerprints the file name, and computes its integrity hash in the same
+// pass. The lock must be held once m is shared, ie. after newAssetManifest.
+func (m *assetManifest) add(name string, fi fs.FileInfo) error {
+	f, err := m.fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h, sri := sha256.New(), sha512.New384()
+	if _, err = io.Copy(io.MultiWriter(h, sri), f); err != nil {
+		return err
+	}
+	if old, ok := m.entries[name]; ok {
+		delete(m.names, old.hashed)
+	}
+	ext := path.Ext(name)
+	hashed := strings.TrimSuffix(name, ext) + "." + hex.EncodeToString(h.Sum(nil))[:assetHashLen] + ext
+	m.entries[name] = &assetEntry{
+		hashed: hashed, modTime: fi.ModTime(), size: fi.Size(),
+		integrity: "sha384-" + base64.StdEncoding.EncodeToString(sri.Sum(nil)),
+	}
+	m.names[hashed] = name
+	return nil
+}
+
+// lookup returns the entry of the file name. In debug mode, the file is
+// fingerprinted again if it changes.
+func (m *assetManifest) lookup(name string) *assetEntry {
+	name = strings.TrimPrefix(name, "/")
+	m.mutex.RLock()
+	e := m.entries[name]
+	m.mutex.RUnlock()
+	if !IsDebugMode {
+		return e
+	}
+	fi, err := fs.Stat(m.fsys, name)
+	if err != nil || fi.IsDir() {
+		return nil
+	}
+	if e != nil && e.modTime.Equal(fi.ModTime()) && e.size == fi.Size() {
+		return e
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if err = m.add(name, fi); err != nil {
+		log.Println("yap: fingerprint asset failed:", err)
+		return nil
+	}
+	return m.entries[name]
+}
+
+// ServeHTTP serves a file by its fingerprinted name or its plain name.
+func (m *assetManifest) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mutex.RLock()
+	name, ok := m.names[r.URL.Path]
+	m.mutex.RUnlock()
+	if ok {
+		r2 := new(http.Request)
+		*r2 = *r
+		u := *r.URL
+		u.Path, u.RawPath = name, ""
+		r2.URL = &u
+		w.Header().Set("Cache-Control", assetCacheControl)
+		r = r2
+	}
+	m.server.ServeHTTP(w, r)
+}
@@ -0,0 +1,101 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package yap
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestAssets(t *testing.T) {
+	e := New(fstest.MapFS{
+		"static/css/app.css": {Data: []byte("body{color:red}")},
+		"page_yap.html":      {Data: []byte(`<link href="{{asset "css/app.css"}}" integrity="{{integrity "css/app.css"}}">`)},
+	})
+	e.Assets("/static")
+
+	url := e.AssetURL("css/app.css")
+	if !regexp.MustCompile(`^/static/css/app\.[0-9a-f]{10}\.css$`).MatchString(url) {
+		t.Fatal("AssetURL:", url)
+	}
+	if s := e.AssetURL("missing.js"); s != "/static/missing.js" {
+		t.Fatal("AssetURL missing:", s)
+	}
+	sri := e.AssetIntegrity("css/app.css")
+	if !strings.HasPrefix(sri, "sha384-") || len(sri) != 7+64 {
+		t.Fatal("AssetIntegrity:", sri)
+	}
+
+	s, err := e.RenderString("page", nil)
+	if err != nil || s != `<link href="`+url+`" integrity="`+strings.ReplaceAll(sri, "+", "&#43;")+`">` {
+		t.Fatal("RenderString:", s, err)
+	}
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+	if w.Code != 200 || w.Body.String() != "body{color:red}" || w.Header().Get("Cache-Control") != assetCacheControl {
+		t.Fatal("fingerprinted:", w.Code, w.Body.String(), w.Header())
+	}
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest("GET", "/static/css/app.css", nil))
+	if w.Code != 200 || w.Header().Get("Cache-Control") != "" {
+		t.Fatal("plain:", w.Code, w.Header())
+	}
+}
+
+func TestAssetsDirs(t *testing.T) {
+	debug := IsDebugMode
+	IsDebugMode = true
+	defer func() { IsDebugMode = debug }()
+
+	fsys := fstest.MapFS{
+		"static/app.js": {Data: []byte("app()")},
+		"vendor/lib.js": {Data: []byte("lib()")},
+	}
+	e := New(fsys)
+	e.Assets("/static")
+	e.Assets("/vendor/", e.FS("vendor"))
+
+	for _, c := range []struct{ name, prefix, data string }{
+		{"app.js", "/static/app.", "app()"},
+		{"lib.js", "/vendor/lib.", "lib()"},
+	} {
+		url := e.AssetURL(c.name)
+		sum := sha512.Sum384([]byte(c.data))
+		if !strings.HasPrefix(url, c.prefix) || e.AssetIntegrity(c.name) != "sha384-"+base64.StdEncoding.EncodeToString(sum[:]) {
+			t.Fatal("asset:", c.name, url, e.AssetIntegrity(c.name))
+		}
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		if w.Code != 200 || w.Body.String() != c.data {
+			t.Fatal("serve:", url, w.Code, w.Body.String())
+		}
+	}
+
+	url, sri := e.AssetURL("lib.js"), e.AssetIntegrity("lib.js")
+	fsys["vendor/lib.js"] = &fstest.MapFile{Data: []byte("lib(2)")}
+	sum := sha512.Sum384([]byte("lib(2)"))
+	if e.AssetURL("lib.js") == url || e.AssetIntegrity("lib.js") == sri ||
+		e.AssetIntegrity("lib.js") != "sha384-"+base64.StdEncoding.EncodeToString(sum[:]) {
+		t.Fatal("changed asset:", e.AssetURL("lib.js"), e.AssetIntegrity("lib.js"))
+	}
+}
@@ -0,0 +1,462 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package yap
+
+import (
+	"container/list"
+	"context"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultCacheEntries is the max number of entries of the default cache store.
+	DefaultCacheEntries = 1024
+
+	// maxCacheBody is the max size of a response body to cache.
+	maxCacheBody = 1 << 20
+)
+
+// CacheEntry represents a cached response.
+type CacheEntry struct {
+	Code    int
+	Header  http.Header
+	Body    []byte
+	Tags    []string  // route pattern and tags of the route
+	Created time.Time // when the response is generated
+	Expires time.Time // the entry is fresh until Expires
+	Stale   time.Time // the entry can be served stale until Stale
+}
+
+// CacheStore represents a store of cached responses.
+type CacheStore interface {
+	Get(key string) (e *CacheEntry, ok bool)
+	Set(key string, e *CacheEntry)
+	Delete(key string)
+
+	// Purge deletes all entries that match reports true.
+	Purge(match func(key string, e *CacheEntry) bool)
+}
+
+// -----------------------------------------------------------------------------
+
+type lruItem struct {
+	key   string
+	entry *CacheEntry
+}
+
+type lruCache struct {
+	mutex      sync.Mutex
+	ll         *list.List
+	items      map[string]*list.Element
+	maxEntries int
+	maxBytes   int64
+	bytes      int64
+}
+
+// NewLRUCache creates an in-memory CacheStore which evicts the least recently
+// used entries when there are more than maxEntries entries, or the total size
+// of response bodies exceeds maxBytes (if specified).
+func NewLRUCache(maxEntries int, maxBytes ...Size) CacheStore {
+	p := &lruCache{ll: list.New(), items: make(map[string]*list.Element), maxEntries: maxEntries}
+	if maxBytes != nil {
+		p.maxBytes = int64(maxBytes[0])
+	}
+	return p
+}
+
+func (p *lruCache) Get(key string) (e *CacheEntry, ok bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if elem, ok := p.items[key]; ok {
+		p.ll.MoveToFront(elem)
+		return elem.Value.(*lruItem).entry, true
+	}
+	return
+}
+
+func (p *lruCache) Set(key string, e *CacheEntry) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if elem, ok := p.items[key]; ok {
+		item := elem.Value.(*lruItem)
+		p.bytes += int64(len(e.Body) - len(item.entry.Body))
+		item.entry = e
+		p.ll.MoveToFront(elem)
+	} else {
+		p.items[key] = p.ll.PushFront(&lruItem{key, e})
+		p.bytes += int64(len(e.Body))
+	}
+	for p.ll.Len() > 1 && (p.ll.Len() > p.maxEntries || (p.maxBytes > 0 && p.bytes > p.maxBytes)) {
+		p.remove(p.ll.Back())
+	}
+}
+
+func (p *lruCache) Delete(key string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if elem, ok := p.items[key]; ok {
+		p.remove(elem)
+	}
+}
+
+func (p *lruCache) Purge(match func(key string, e *CacheEntry) bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for elem := p.ll.Front(); elem != nil; {
+		next := elem.Next()
+		if item := elem.Value.(*lruItem); match(item.key, item.entry) {
+			p.remove(elem)
+		}
+		elem = next
+	}
+}
+
+func (p *lruCache) remove(elem *list.Element) {
+	item := p.ll.Remove(elem).(*lruItem)
+	delete(p.items, item.key)
+	p.bytes -= int64(len(item.entry.Body))
+}
+
+// -----------------------------------------------------------------------------
+
+type respCache struct {
+	mutex  sync.Mutex
+	store  CacheStore
+	bypass func(req *http.Request) bool
+}
+
+// SetCacheStore sets the store of the response cache (default is an LRU
+// cache of DefaultCacheEntries entries). See Cache.
+func (p *Engine) SetCacheStore(store CacheStore) {
+	p.cache.mutex.Lock()
+	p.cache.store = store
+	p.cache.mutex.Unlock()
+}
+
+// CacheStore returns the store of the response cache.
+func (p *Engine) CacheStore() CacheStore {
+	p.cache.mutex.Lock()
+	defer p.cache.mutex.Unlock()
+	if p.cache.store == nil {
+		p.cache.store = NewLRUCache(DefaultCacheEntries)
+	}
+	return p.cache.store
+}
+
+// SetCacheBypass sets the function that reports whether a request must not
+// be served from (or stored in) the response cache. By default, requests with
+// an Authorization or Cookie header are bypassed, since their responses are
+// likely personalized.
+func (p *Engine) SetCacheBypass(bypass func(req *http.Request) bool) {
+	p.cache.mutex.Lock()
+	p.cache.bypass = bypass
+	p.cache.mutex.Unlock()
+}
+
+func (p *Engine) cacheBypass(req *http.Request) bool {
+	p.cache.mutex.Lock()
+	bypass := p.cache.bypass
+	p.cache.mutex.Unlock()
+	if bypass == nil {
+		return req.Header.Get("Authorization") != "" || req.Header.Get("Cookie") != ""
+	}
+	return bypass(req)
+}
+
+// PurgeCache deletes cached responses of routes with any of the tags. A route
+// pattern (eg. "/p/:id") is a tag of its route.
+func (p *Engine) PurgeCache(tags ...string) {
+	p.CacheStore().Purge(func(key string, e *CacheEntry) bool {
+		for _, tag := range e.Tags {
+			for _, t := range tags {
+				if tag == t {
+					return true
+				}
+			}
+		}
+		return false
+	})
+}
+
+// PurgeCache deletes cached responses of routes with any of the tags.
+// See Engine.PurgeCache.
+func (p *Context) PurgeCache(tags ...string) {
+	p.engine.PurgeCache(tags...)
+}
+
+// -----------------------------------------------------------------------------
+
+// Cache caches GET responses of a route for ttl. Tags can be used to purge
+// the cached responses, see Engine.PurgeCache. Responses are cached by route
+// pattern, path, query and request headers listed in the Vary header. Only
+// 200, 301, 404 and 410 responses without Set-Cookie, without Vary: Cookie and
+// without private, no-cache or no-store Cache-Control directives are cached.
+// Requests with an Authorization or Cookie header bypass the cache by default,
+// see Engine.SetCacheBypass.
+func Cache(ttl time.Duration, tags ...string) RouteOption {
+	return func(opts *routeOptions) {
+		opts.cacheTTL, opts.cacheTags = ttl, tags
+	}
+}
+
+// StaleWhileRevalidate allows a cached response to be served for d after it
+// expires, while it is revalidated in background. See Cache.
+func StaleWhileRevalidate(d time.Duration) RouteOption {
+	return func(opts *routeOptions) {
+		opts.cacheSWR = d
+	}
+}
+
+type routeCache struct {
+	pattern  string
+	ttl, swr time.Duration
+	tags     []string
+	vary     atomic.Value // []string
+	mutex    sync.Mutex
+	updating map[string]bool
+}
+
+func cacheHandle(handle func(ctx *Context), pattern string, o *routeOptions) func(ctx *Context) {
+	rc := &routeCache{
+		pattern: pattern, ttl: o.cacheTTL, swr: o.cacheSWR,
+		tags: append([]string{pattern}, o.cacheTags...), updating: make(map[string]bool),
+	}
+	return func(ctx *Context) {
+		req := ctx.Request
+		method := req.Method
+		if (method != http.MethodGet && method != http.MethodHead) || ctx.engine.cacheBypass(req) {
+			handle(ctx)
+			return
+		}
+		store := ctx.engine.CacheStore()
+		key := rc.key(req)
+		if e, ok := store.Get(key); ok {
+			now := time.Now()
+			if now.Before(e.Expires) {
+				serveCached(ctx, e, now, "HIT")
+				return
+			}
+			if now.Before(e.Stale) {
+				serveCached(ctx, e, now, "STALE")
+				rc.revalidate(ctx.engine, handle, req, key)
+				return
+			}
+		}
+		if method == http.MethodHead {
+			handle(ctx)
+			return
+		}
+		w := &cacheWriter{ResponseWriter: ctx.ResponseWriter}
+		ctx.ResponseWriter = w
+		handle(ctx)
+		rc.store(store, req, key, w)
+	}
+}
+
+func (p *routeCache) key(req *http.Request) string {
+	var b strings.Builder
+	b.WriteString(p.pattern)
+	b.WriteByte(0)
+	b.WriteString(req.URL.Path)
+	b.WriteByte('?')
+	b.WriteString(req.URL.Query().Encode())
+	if vary, ok := p.vary.Load().([]string); ok {
+		for _, name := range vary {
+			b.WriteByte(0)
+			b.WriteString(strings.Join(req.Header.Values(name), ","))
+		}
+	}
+	return b.String()
+}
+
+func (p *routeCache) store(store CacheStore, req *http.Request, key string, w *cacheWriter) {
+	if w.overflow || !cacheable(w.code, w.Header()) {
+		return
+	}
+	vary := varyHeaders(w.Header())
+	if vary != nil && vary[0] == "*" {
+		return
+	}
+	if old, _ := p.vary.Load().([]string); !equalStrings(old, vary) {
+		p.vary.Store(vary) // the key changes with Vary
+		key = p.key(req)
+	}
+	now := time.Now()
+	store.Set(key, &CacheEntry{
+		Code:    w.code,
+		Header:  w.Header().Clone(),
+		Body:    w.buf,
+		Tags:    p.tags,
+		Created: now,
+		Expires: now.Add(p.ttl),
+		Stale:   now.Add(p.ttl + p.swr),
+	})
+}
+
+// revalidate regenerates the response of key in background.
+func (p *routeCache) revalidate(e *Engine, handle func(ctx *Context), req *http.Request, key string) {
+	p.mutex.Lock()
+	if p.updating[key] {
+		p.mutex.Unlock()
+		return
+	}
+	p.updating[key] = true
+	p.mutex.Unlock()
+
+	req = req.Clone(context.Background())
+	req.Header.Del("If-None-Match")
+	req.Header.Del("If-Modified-Since")
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				log.Println("yap: revalidate", req.URL.Path, "failed:", err)
+			}
+			p.mutex.Lock()
+			delete(p.updating, key)
+			p.mutex.Unlock()
+		}()
+		w := &cacheWriter{ResponseWriter: discardWriter{make(http.Header)}}
+		handle(e.NewContext(w, req))
+		p.store(e.CacheStore(), req, key, w)
+	}()
+}
+
+func serveCached(ctx *Context, e *CacheEntry, now time.Time, status string) {
+	h := ctx.ResponseWriter.Header()
+	for k, v := range e.Header {
+		h[k] = append([]string(nil), v...)
+	}
+	h.Set("Age", strconv.Itoa(int(now.Sub(e.Created)/time.Second)))
+	h.Set("X-Cache", status)
+	if e.Code == http.StatusOK {
+		if code := checkPreconditions(ctx.Request, h); code != 0 {
+			writeNotModified(ctx.ResponseWriter, code)
+			return
+		}
+	}
+	ctx.ResponseWriter.WriteHeader(e.Code)
+	if ctx.Method != http.MethodHead {
+		ctx.ResponseWriter.Write(e.Body)
+	}
+}
+
+func cacheable(code int, h http.Header) bool {
+	switch code {
+	case http.StatusOK, http.StatusMovedPermanently, http.StatusNotFound, http.StatusGone:
+	default:
+		return false
+	}
+	if h.Get("Set-Cookie") != "" {
+		return false
+	}
+	for _, name := range varyHeaders(h) {
+		if name == "Cookie" {
+			return false
+		}
+	}
+	for _, v := range h.Values("Cache-Control") {
+		for _, d := range strings.Split(v, ",") {
+			switch strings.ToLower(strings.TrimSpace(d)) {
+			case "no-store", "private", "no-cache":
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func varyHeaders(h http.Header) (vary []string) {
+	for _, v := range h.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name == "*" {
+				return []string{"*"}
+			} else if name != "" {
+				vary = append(vary, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	sort.Strings(vary)
+	return
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i, v := range a {
+		if b[i] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// cacheWriter is a ResponseWriter which records the response while writing it.
+type cacheWriter struct {
+	http.ResponseWriter
+	code     int
+	buf      []byte
+	overflow bool
+}
+
+func (p *cacheWriter) WriteHeader(code int) {
+	if p.code == 0 {
+		p.code = code
+	}
+	p.ResponseWriter.WriteHeader(code)
+}
+
+func (p *cacheWriter) Write(b []byte) (int, error) {
+	if p.code == 0 {
+		p.code = http.StatusOK
+	}
+	if !p.overflow {
+		if len(p.buf)+len(b) > maxCacheBody {
+			p.overflow, p.buf = true, nil
+		} else {
+			p.buf = append(p.buf, b...)
+		}
+	}
+	return p.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher.
+func (p *cacheWriter) Flush() {
+	if f, ok := p.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying ResponseWriter.
+func (p *cacheWriter) Unwrap() http.ResponseWriter {
+	return p.ResponseWriter
+}
+
+type discardWriter struct {
+	h http.Header
+}
+
+func (p discardWriter) Header() http.Header         { return p.h }
+func (p discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (p discardWriter) WriteHeader(code int)        {}
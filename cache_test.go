@@ -0,0 +1,143 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package yap
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	e := New()
+	var n int32
+	e.GET("/p/:id", func(ctx *Context) {
+		ctx.ResponseWriter.Header().Set("Vary", "Accept-Language")
+		v := atomic.AddInt32(&n, 1)
+		ctx.TEXT(200, "text/plain", ctx.Param("id")+ctx.Request.Header.Get("Accept-Language")+strconv.Itoa(int(v)))
+	}, Cache(time.Hour, "posts"))
+	get := func(path string, hdr ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		for i := 0; i < len(hdr); i += 2 {
+			req.Header.Set(hdr[i], hdr[i+1])
+		}
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, req)
+		return w
+	}
+	if w := get("/p/1"); w.Body.String() != "11" {
+		t.Fatal("miss:", w.Body.String())
+	}
+	if w := get("/p/1"); w.Body.String() != "11" || w.Header().Get("X-Cache") != "HIT" {
+		t.Fatal("hit:", w.Body.String(), w.Header())
+	}
+	if w := get("/p/1", "Accept-Language", "en"); w.Body.String() != "1en2" {
+		t.Fatal("vary:", w.Body.String())
+	}
+	if w := get("/p/1", "Authorization", "Bearer x"); w.Body.String() != "13" {
+		t.Fatal("bypass:", w.Body.String())
+	}
+	if w := get("/p/1", "Cookie", "session=x"); w.Body.String() != "14" {
+		t.Fatal("bypass cookie:", w.Body.String())
+	}
+	e.PurgeCache("posts")
+	if w := get("/p/1"); w.Body.String() != "15" {
+		t.Fatal("purge:", w.Body.String())
+	}
+}
+
+func TestCacheCookie(t *testing.T) {
+	e := New()
+	var n int32
+	e.GET("/login", func(ctx *Context) {
+		http.SetCookie(ctx.ResponseWriter, &http.Cookie{Name: "session", Value: "x"})
+		ctx.TEXT(200, "text/plain", strconv.Itoa(int(atomic.AddInt32(&n, 1))))
+	}, Cache(time.Hour))
+	e.GET("/home", func(ctx *Context) {
+		ctx.ResponseWriter.Header().Set("Vary", "Accept-Encoding, Cookie")
+		ctx.TEXT(200, "text/plain", strconv.Itoa(int(atomic.AddInt32(&n, 1))))
+	}, Cache(time.Hour))
+	get := func(path string) string {
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w.Body.String()
+	}
+	if a, b := get("/login"), get("/login"); a == b {
+		t.Fatal("Set-Cookie is cached:", a, b)
+	}
+	if a, b := get("/home"), get("/home"); a == b {
+		t.Fatal("Vary: Cookie is cached:", a, b)
+	}
+
+	e.SetCacheBypass(func(req *http.Request) bool { return false })
+	e.GET("/public", func(ctx *Context) {
+		ctx.TEXT(200, "text/plain", strconv.Itoa(int(atomic.AddInt32(&n, 1))))
+	}, Cache(time.Hour))
+	req := httptest.NewRequest("GET", "/public", nil)
+	req.Header.Set("Cookie", "session=x")
+	w1, w2 := httptest.NewRecorder(), httptest.NewRecorder()
+	e.ServeHTTP(w1, req)
+	e.ServeHTTP(w2, req)
+	if w1.Body.String() != w2.Body.String() {
+		t.Fatal("custom bypass:", w1.Body.String(), w2.Body.String())
+	}
+}
+
+func TestCacheStale(t *testing.T) {
+	e := New()
+	var n int32
+	done := make(chan struct{}, 1)
+	e.GET("/", func(ctx *Context) {
+		ctx.TEXT(200, "text/plain", strconv.Itoa(int(atomic.AddInt32(&n, 1))))
+		done <- struct{}{}
+	}, Cache(time.Millisecond), StaleWhileRevalidate(time.Hour))
+	get := func() string {
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		return w.Body.String()
+	}
+	get()
+	<-done
+	time.Sleep(2 * time.Millisecond)
+	if ret := get(); ret != "1" {
+		t.Fatal("stale:", ret)
+	}
+	<-done
+	for i := 0; i < 100 && get() != "2"; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if ret := get(); ret != "2" {
+		t.Fatal("revalidate:", ret)
+	}
+}
+
+func TestLRUCache(t *testing.T) {
+	c := NewLRUCache(2, 10)
+	c.Set("a", &CacheEntry{Body: []byte("12345")})
+	c.Set("b", &CacheEntry{Body: []byte("12345")})
+	c.Get("a")
+	c.Set("c", &CacheEntry{Body: []byte("1")})
+	if _, ok := c.Get("b"); ok {
+		t.Fatal("LRU: b not evicted")
+	}
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("LRU: a evicted")
+	}
+}
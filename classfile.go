@@ -18,8 +18,11 @@ package yap
 
 import (
 	"context"
+	"html/template"
 	"io/fs"
+	"log"
 	"net/http"
+	"time"
 
 	"github.com/qiniu/x/http/fsx"
 )
@@ -32,39 +35,39 @@ type App struct {
 	Engine
 }
 
-// Get is a shortcut for router.Route(http.MethodGet, path, handle)
-func (p *App) Get(path string, handle func(ctx *Context)) {
-	p.Route(http.MethodGet, path, handle)
+// Get is a shortcut for router.Route(http.MethodGet, path, handle, opts...)
+func (p *App) Get(path string, handle func(ctx *Context), opts ...RouteOption) {
+	p.Route(http.MethodGet, path, handle, opts...)
 }
 
-// Head is a shortcut for router.Route(http.MethodHead, path, handle)
-func (p *App) Head(path string, handle func(ctx *Context)) {
-	p.Route(http.MethodHead, path, handle)
+// Head is a shortcut for router.Route(http.MethodHead, path, handle, opts...)
+func (p *App) Head(path string, handle func(ctx *Context), opts ...RouteOption) {
+	p.Route(http.MethodHead, path, handle, opts...)
 }
 
-// Options is a shortcut for router.Route(http.MethodOptions, path, handle)
-func (p *App) Options(path string, handle func(ctx *Context)) {
-	p.Route(http.MethodOptions, path, handle)
+// Options is a shortcut for router.Route(http.MethodOptions, path, handle, opts...)
+func (p *App) Options(path string, handle func(ctx *Context), opts ...RouteOption) {
+	p.Route(http.MethodOptions, path, handle, opts...)
 }
 
-// Post is a shortcut for router.Route(http.MethodPost, path, handle)
-func (p *App) Post(path string, handle func(ctx *Context)) {
-	p.Route(http.MethodPost, path, handle)
+// Post is a shortcut for router.Route(http.MethodPost, path, handle, opts...)
+func (p *App) Post(path string, handle func(ctx *Context), opts ...RouteOption) {
+	p.Route(http.MethodPost, path, handle, opts...)
 }
 
-// Put is a shortcut for router.Route(http.MethodPut, path, handle)
-func (p *App) Put(path string, handle func(ctx *Context)) {
-	p.Route(http.MethodPut, path, handle)
+// Put is a shortcut for router.Route(http.MethodPut, path, handle, opts...)
+func (p *App) Put(path string, handle func(ctx *Context), opts ...RouteOption) {
+	p.Route(http.MethodPut, path, handle, opts...)
 }
 
-// Patch is a shortcut for router.Route(http.MethodPatch, path, handle)
-func (p *App) Patch(path string, handle func(ctx *Context)) {
-	p.Route(http.MethodPatch, path, handle)
+// Patch is a shortcut for router.Route(http.MethodPatch, path, handle, opts...)
+func (p *App) Patch(path string, handle func(ctx *Context), opts ...RouteOption) {
+	p.Route(http.MethodPatch, path, handle, opts...)
 }
 
-// Delete is a shortcut for router.Route(http.MethodDelete, path, handle)
-func (p *App) Delete(path string, handle func(ctx *Context)) {
-	p.Route(http.MethodDelete, path, handle)
+// Delete is a shortcut for router.Route(http.MethodDelete, path, handle, opts...)
+func (p *App) Delete(path string, handle func(ctx *Context), opts ...RouteOption) {
+	p.Route(http.MethodDelete, path, handle, opts...)
 }
 
 // Static serves static files from a dir (default is "$YapFS/static").
@@ -72,9 +75,13 @@ func (p *App) Static__0(pattern string, dir ...fs.FS) {
 	p.Static(pattern, dir...)
 }
 
-// Static serves static files from a http file system scheme (url).
+// Static serves static files from a http file system scheme (url), or from a
+// .zip, .tar, .tar.gz or .tgz file (see Engine.Archive).
 // See https://pkg.go.dev/github.com/qiniu/x/http/fsx for more information.
 func (p *App) Static__1(pattern string, ctx context.Context, url string) (closer fsx.Closer, err error) {
+	if isArchive(url) {
+		return p.staticArchive(pattern, url)
+	}
 	fs, closer, err := fsx.Open(ctx, url)
 	if err == nil {
 		p.StaticHttp(pattern, fs, false)
@@ -101,6 +108,35 @@ func (p *App) SetDelims(left, right string) {
 	p.Engine.SetDelims(left, right)
 }
 
+// Funcs adds funcs to YAP templates, example:
+//
+//	funcs {
+//		"upper": strings.ToUpper,
+//	}
+func (p *App) Funcs(funcs template.FuncMap) {
+	p.Engine.Funcs(funcs)
+}
+
+// Config loads conf (a pointer to struct) from environment variables, .env and
+// config files in $YapFS. It panics with all invalid or missing fields.
+// See Engine.LoadConfig for more information.
+func (p *App) Config(conf any, files ...string) {
+	if err := p.Engine.LoadConfig(conf, files...); err != nil {
+		log.Panicln("yap: invalid config:\n" + err.Error())
+	}
+}
+
+// ShutdownTimeout sets the time to wait for in-flight requests to complete
+// when shutting down, example:
+//
+//	shutdownTimeout 30*time.Second
+//	onShutdown => {
+//		...
+//	}
+func (p *App) ShutdownTimeout(d time.Duration) {
+	p.Engine.SetShutdownTimeout(d)
+}
+
 // AppType represents an abstract of YAP applications.
 type AppType interface {
 	InitYap(fs ...fs.FS)
@@ -196,6 +232,30 @@ func (p *Context) PrettyJson__1(data interface{}) {
 	p.PrettyJSON(200, data)
 }
 
+func (p *Context) Xml__0(code int, data interface{}) {
+	p.XML(code, data)
+}
+
+func (p *Context) Xml__1(data interface{}) {
+	p.XML(200, data)
+}
+
+func (p *Context) Csv__0(code int, filename string, data interface{}) {
+	p.CSV(code, filename, data)
+}
+
+func (p *Context) Csv__1(filename string, data interface{}) {
+	p.CSV(200, filename, data)
+}
+
+func (p *Context) Ndjson__0(code int, data interface{}) {
+	p.NDJSON(code, data)
+}
+
+func (p *Context) Ndjson__1(data interface{}) {
+	p.NDJSON(200, data)
+}
+
 func (p *Context) Yap__0(code int, yapFile string, data interface{}) {
 	p.YAP(code, yapFile, data)
 }
@@ -203,3 +263,19 @@ func (p *Context) Yap__0(code int, yapFile string, data interface{}) {
 func (p *Context) Yap__1(yapFile string, data interface{}) {
 	p.YAP(200, yapFile, data)
 }
+
+func (p *Context) YapText__0(code int, yapFile string, data interface{}) {
+	p.YAPText(code, yapFile, data)
+}
+
+func (p *Context) YapText__1(yapFile string, data interface{}) {
+	p.YAPText(200, yapFile, data)
+}
+
+func (p *Context) YapBlock__0(code int, yapFile, block string, data interface{}) {
+	p.YAPBlock(code, yapFile, block, data)
+}
+
+func (p *Context) YapBlock__1(yapFile, block string, data interface{}) {
+	p.YAPBlock(200, yapFile, block, data)
+}
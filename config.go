@@ -0,0 +1,498 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package yap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// DefaultConfigFiles are config files loaded (if exist) from $YapFS by
+// LoadConfig when no file is specified.
+var DefaultConfigFiles = []string{"config.json", "config.toml"}
+
+// LoadConfig fills conf (a pointer to struct) from, in order of precedence:
+//   - environment variables (including the ones loaded from .env)
+//   - config files in $YapFS (default is DefaultConfigFiles)
+//   - defaults specified by `default` tags
+//
+// Each field is named by its `env` tag, or by its name in UPPER_SNAKE_CASE.
+// Fields of a nested struct are prefixed by the name of the struct field. For
+// example:
+//
+//	type Config struct {
+//		Addr    string        `default:":8080"`
+//		Timeout time.Duration `env:"TIMEOUT" default:"5s"`
+//		MaxBody yap.Size      `default:"10MB"`
+//		DB      struct {
+//			DSN string `env:"DSN,required,secret"`  // DB_DSN
+//		}
+//	}
+//
+// Options of `env` tag are:
+//   - required: it's an error if the field isn't set by any source
+//   - secret: the value is redacted in logs (see FormatConfig)
+//
+// Keys of config files are matched case-insensitively, and keys of nested
+// objects (JSON) or sections (TOML) are joined by '_': `{"db": {"dsn": ""}}`
+// and `[db] dsn = ""` both set DB_DSN.
+//
+// All invalid or missing fields are reported by a *ConfigError.
+func (p *Engine) LoadConfig(conf any, files ...string) error {
+	v := reflect.ValueOf(conf)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return errors.New("yap: config must be a pointer to struct")
+	}
+	optional := files == nil
+	if optional {
+		files = DefaultConfigFiles
+	}
+	vals := make(map[string]string)
+	for _, file := range files {
+		b, err := fs.ReadFile(p.yapFS(), file)
+		if err != nil {
+			if optional && errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return err
+		}
+		if err = parseConfigFile(vals, file, b); err != nil {
+			return err
+		}
+	}
+	errs := new(ConfigError)
+	loadConfig(v.Elem(), "", vals, errs)
+	if errs.Errs != nil {
+		return errs
+	}
+	if IsDebugMode {
+		debugPrint("Config:\n%s", FormatConfig(conf))
+	}
+	return nil
+}
+
+// ConfigError reports all invalid or missing fields of a config.
+type ConfigError struct {
+	Errs []error
+}
+
+func (p *ConfigError) Error() string {
+	msgs := make([]string, len(p.Errs))
+	for i, err := range p.Errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (p *ConfigError) add(name string, err error) {
+	p.Errs = append(p.Errs, fmt.Errorf("config %s: %w", name, err))
+}
+
+var errRequired = errors.New("required but not set")
+
+type configField struct {
+	name     string
+	def      string
+	hasDef   bool
+	required bool
+	secret   bool
+}
+
+func walkConfig(v reflect.Value, prefix string, f func(fld configField, v reflect.Value)) {
+	t := v.Type()
+	for i, n := 0, t.NumField(); i < n; i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		tag := sf.Tag.Get("env")
+		if tag == "-" {
+			continue
+		}
+		opts := strings.Split(tag, ",")
+		fld := configField{name: opts[0]}
+		for _, opt := range opts[1:] {
+			switch opt {
+			case "required":
+				fld.required = true
+			case "secret":
+				fld.secret = true
+			}
+		}
+		fv := v.Field(i)
+		if isConfigStruct(sf.Type) {
+			if sf.Anonymous && fld.name == "" {
+				walkConfig(fv, prefix, f)
+			} else {
+				if fld.name == "" {
+					fld.name = snakeName(sf.Name)
+				}
+				walkConfig(fv, prefix+fld.name+"_", f)
+			}
+			continue
+		}
+		if fld.name == "" {
+			fld.name = snakeName(sf.Name)
+		}
+		fld.name = prefix + fld.name
+		fld.def, fld.hasDef = sf.Tag.Lookup("default")
+		f(fld, fv)
+	}
+}
+
+func isConfigStruct(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct || t == tyTime {
+		return false
+	}
+	return !reflect.PtrTo(t).Implements(tyTextUnmarshaler)
+}
+
+func loadConfig(v reflect.Value, prefix string, vals map[string]string, errs *ConfigError) {
+	walkConfig(v, prefix, func(fld configField, fv reflect.Value) {
+		val, ok := os.LookupEnv(fld.name)
+		if !ok {
+			val, ok = vals[fld.name]
+		}
+		if !ok {
+			val, ok = fld.def, fld.hasDef
+		}
+		if !ok || (val == "" && fld.required) {
+			if fld.required {
+				errs.add(fld.name, errRequired)
+			}
+			return
+		}
+		if err := setConfigValue(fv, val); err != nil {
+			if fld.secret {
+				err = errors.New("invalid value") // don't leak the secret
+			}
+			errs.add(fld.name, err)
+		}
+	})
+}
+
+var (
+	tyDuration        = reflect.TypeOf(time.Duration(0))
+	tyTime            = reflect.TypeOf(time.Time{})
+	tyTextUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+func setConfigValue(v reflect.Value, val string) error {
+	if v.CanAddr() {
+		if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			return u.UnmarshalText([]byte(val))
+		}
+	}
+	switch v.Type() {
+	case tyDuration:
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	case tyTime:
+		t, err := time.Parse(time.RFC3339, val)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(val)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(val, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(val, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(val, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		var items []string
+		if val = strings.TrimSpace(val); val != "" {
+			items = strings.Split(val, ",")
+		}
+		s := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := setConfigValue(s.Index(i), strings.TrimSpace(item)); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+	default:
+		return fmt.Errorf("unsupported type %v", v.Type())
+	}
+	return nil
+}
+
+// FormatConfig formats conf (a pointer to struct loaded by LoadConfig) as
+// NAME=value lines, with values of secret fields redacted.
+func FormatConfig(conf any) string {
+	var b strings.Builder
+	walkConfig(reflect.ValueOf(conf).Elem(), "", func(fld configField, fv reflect.Value) {
+		b.WriteString(fld.name)
+		b.WriteByte('=')
+		if fld.secret {
+			if !fv.IsZero() {
+				b.WriteString("******")
+			}
+		} else {
+			fmt.Fprint(&b, fv.Interface())
+		}
+		b.WriteByte('\n')
+	})
+	return b.String()
+}
+
+// snakeName converts a Go name to UPPER_SNAKE_CASE, eg. MaxBodySize =>
+// MAX_BODY_SIZE, DBAddr => DB_ADDR.
+func snakeName(name string) string {
+	var b strings.Builder
+	rs := []rune(name)
+	for i, r := range rs {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := rs[i-1]
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) ||
+				(i+1 < len(rs) && unicode.IsLower(rs[i+1])) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
+
+func configKey(key string) string {
+	key = strings.ToUpper(strings.TrimSpace(key))
+	return strings.NewReplacer(".", "_", "-", "_").Replace(key)
+}
+
+// -----------------------------------------------------------------------------
+
+func parseConfigFile(vals map[string]string, file string, b []byte) error {
+	var err error
+	switch path.Ext(file) {
+	case ".json":
+		err = parseJSONConfig(vals, b)
+	default:
+		err = parseTOMLConfig(vals, b)
+	}
+	if err != nil {
+		return fmt.Errorf("yap: parse config %s: %w", file, err)
+	}
+	return nil
+}
+
+func parseJSONConfig(vals map[string]string, b []byte) error {
+	var doc map[string]any
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return err
+	}
+	flattenJSON(vals, "", doc)
+	return nil
+}
+
+func flattenJSON(vals map[string]string, prefix string, doc map[string]any) {
+	for k, v := range doc {
+		key := prefix + configKey(k)
+		switch v := v.(type) {
+		case map[string]any:
+			flattenJSON(vals, key+"_", v)
+		case []any:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			vals[key] = strings.Join(items, ",")
+		case nil:
+		default:
+			vals[key] = fmt.Sprint(v)
+		}
+	}
+}
+
+// parseTOMLConfig parses a TOML-like config: `key = value` pairs, [section]
+// headers and # comments. Values are quoted strings, arrays of values, or
+// bare words.
+func parseTOMLConfig(vals map[string]string, b []byte) error {
+	prefix := ""
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || text[0] == '#' {
+			continue
+		}
+		if text[0] == '[' {
+			if !strings.HasSuffix(text, "]") {
+				return fmt.Errorf("line %d: invalid section", line)
+			}
+			prefix = configKey(text[1:len(text)-1]) + "_"
+			continue
+		}
+		pos := strings.IndexByte(text, '=')
+		if pos <= 0 {
+			return fmt.Errorf("line %d: expect key = value", line)
+		}
+		val, err := tomlValue(strings.TrimSpace(text[pos+1:]))
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		vals[prefix+configKey(text[:pos])] = val
+	}
+	return scanner.Err()
+}
+
+func tomlValue(text string) (string, error) {
+	if text == "" {
+		return "", nil
+	}
+	switch text[0] {
+	case '"':
+		end := closingQuote(text)
+		if end < 0 {
+			return "", errors.New("unterminated string")
+		}
+		return strconv.Unquote(text[:end+1])
+	case '\'':
+		end := strings.IndexByte(text[1:], '\'')
+		if end < 0 {
+			return "", errors.New("unterminated string")
+		}
+		return text[1 : end+1], nil
+	case '[':
+		end := strings.LastIndexByte(text, ']')
+		if end < 0 {
+			return "", errors.New("unterminated array")
+		}
+		var items []string
+		for _, item := range strings.Split(text[1:end], ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			v, err := tomlValue(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, v)
+		}
+		return strings.Join(items, ","), nil
+	}
+	if pos := strings.Index(text, " #"); pos >= 0 {
+		text = strings.TrimSpace(text[:pos])
+	}
+	return text, nil
+}
+
+func closingQuote(text string) int {
+	for i := 1; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+// -----------------------------------------------------------------------------
+
+// Size represents a number of bytes. It can be loaded from a config value
+// like "512", "64KB", "1.5MiB" or "2G". Units are powers of 1024.
+type Size int64
+
+const (
+	KB Size = 1 << (10 * (iota + 1))
+	MB
+	GB
+	TB
+)
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (p *Size) UnmarshalText(text []byte) error {
+	s := strings.TrimSpace(string(text))
+	n := len(s)
+	for n > 0 && (s[n-1] < '0' || s[n-1] > '9') && s[n-1] != '.' {
+		n--
+	}
+	unit := Size(1)
+	switch strings.ToUpper(strings.TrimSpace(s[n:])) {
+	case "", "B":
+	case "K", "KB", "KIB":
+		unit = KB
+	case "M", "MB", "MIB":
+		unit = MB
+	case "G", "GB", "GIB":
+		unit = GB
+	case "T", "TB", "TIB":
+		unit = TB
+	default:
+		return fmt.Errorf("invalid size %q", s)
+	}
+	f, err := strconv.ParseFloat(s[:n], 64)
+	if err != nil || f < 0 {
+		return fmt.Errorf("invalid size %q", s)
+	}
+	*p = Size(f * float64(unit))
+	return nil
+}
+
+func (p Size) String() string {
+	units := []struct {
+		size Size
+		name string
+	}{{TB, "TB"}, {GB, "GB"}, {MB, "MB"}, {KB, "KB"}}
+	for _, u := range units {
+		if p >= u.size && p%u.size == 0 {
+			return strconv.FormatInt(int64(p/u.size), 10) + u.name
+		}
+	}
+	return strconv.FormatInt(int64(p), 10) + "B"
+}
@@ -0,0 +1,102 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package yap
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+type testConfig struct {
+	Addr    string        `default:":8080"`
+	Timeout time.Duration `env:"TIMEOUT" default:"5s"`
+	MaxBody Size          `default:"10MB"`
+	Hosts   []string
+	DB      struct {
+		DSN   string `env:"DSN,required,secret"`
+		Debug bool
+	}
+	Token string `env:"API_TOKEN,required,secret"`
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Setenv("TIMEOUT", "1m")
+	t.Setenv("API_TOKEN", "abc")
+	e := New(fstest.MapFS{
+		"config.toml": {Data: []byte(`
+# comment
+hosts = ["a.com", 'b.com']
+[db]
+dsn = "root@/test" # comment
+debug = true
+`)},
+	})
+	var conf testConfig
+	if err := e.LoadConfig(&conf); err != nil {
+		t.Fatal("LoadConfig:", err)
+	}
+	if conf.Addr != ":8080" || conf.Timeout != time.Minute || conf.MaxBody != 10*MB ||
+		len(conf.Hosts) != 2 || conf.Hosts[1] != "b.com" ||
+		conf.DB.DSN != "root@/test" || !conf.DB.Debug || conf.Token != "abc" {
+		t.Fatalf("LoadConfig: %+v\n", conf)
+	}
+	s := FormatConfig(&conf)
+	if strings.Contains(s, "abc") || strings.Contains(s, "root@") || !strings.Contains(s, "MAX_BODY=10MB\n") {
+		t.Fatal("FormatConfig:", s)
+	}
+}
+
+func TestConfigError(t *testing.T) {
+	t.Setenv("MAX_BODY", "10XB")
+	e := New(fstest.MapFS{
+		"config.json": {Data: []byte(`{"timeout": "1x", "db": {"debug": "maybe"}}`)},
+	})
+	var conf testConfig
+	err := e.LoadConfig(&conf)
+	var cerr *ConfigError
+	if !errors.As(err, &cerr) || len(cerr.Errs) != 5 || !errors.Is(cerr.Errs[4], errRequired) {
+		t.Fatal("LoadConfig:", err)
+	}
+	if err = e.LoadConfig(&conf, "notfound.json"); err == nil {
+		t.Fatal("LoadConfig: no error")
+	}
+}
+
+func TestSize(t *testing.T) {
+	cases := map[string]Size{"512": 512, "64KB": 64 * KB, "1.5MiB": MB + MB/2, "2 g": 2 * GB}
+	for in, want := range cases {
+		var s Size
+		if err := s.UnmarshalText([]byte(in)); err != nil || s != want {
+			t.Fatal("Size:", in, s, err)
+		}
+	}
+	if s := Size(1536); s.String() != "1536B" {
+		t.Fatal("Size.String:", s)
+	}
+}
+
+func TestSnakeName(t *testing.T) {
+	cases := map[string]string{"MaxBodySize": "MAX_BODY_SIZE", "DBAddr": "DB_ADDR", "HTTP2": "HTTP2", "ID": "ID"}
+	for in, want := range cases {
+		if ret := snakeName(in); ret != want {
+			t.Fatal("snakeName:", in, ret)
+		}
+	}
+}
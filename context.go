@@ -17,12 +17,14 @@
 package yap
 
 import (
+	"bytes"
 	"encoding/json"
 	"io"
 	"log"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 type Context struct {
@@ -30,6 +32,9 @@ type Context struct {
 	http.ResponseWriter
 
 	engine *Engine
+	etag   int
+	layout string
+	locale string
 }
 
 func (p *Context) setParam(name, val string) {
@@ -99,6 +104,10 @@ func (p *Context) Redirect(url string, code ...int) {
 }
 
 func (p *Context) TEXT(code int, mime string, text string) {
+	if p.etag != etagNone {
+		p.DATA(code, mime, []byte(text))
+		return
+	}
 	w := p.ResponseWriter
 	h := w.Header()
 	h.Set("Content-Length", strconv.Itoa(len(text)))
@@ -110,6 +119,9 @@ func (p *Context) TEXT(code int, mime string, text string) {
 func (p *Context) DATA(code int, mime string, data []byte) {
 	w := p.ResponseWriter
 	h := w.Header()
+	if p.writeETagged(code, data) {
+		return
+	}
 	h.Set("Content-Length", strconv.Itoa(len(data)))
 	h.Set("Content-Type", mime)
 	w.WriteHeader(code)
@@ -132,13 +144,60 @@ func (p *Context) JSON(code int, data interface{}) {
 	p.DATA(code, "application/json", msg)
 }
 
+var bufPool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+const maxPooledBuf = 64 << 10
+
+func getBuf() *bytes.Buffer {
+	return bufPool.Get().(*bytes.Buffer)
+}
+
+// putBuf puts buf back to bufPool, unless it grows too large.
+func putBuf(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledBuf {
+		buf.Reset()
+		bufPool.Put(buf)
+	}
+}
+
+// YAP renders the template yapFile with data into a buffer, and then writes
+// the response with the status code. If rendering fails, nothing is written
+// and a *TemplateError is passed to PanicHandler (if set), or the request is
+// answered with 500 Internal Server Error.
 func (p *Context) YAP(code int, yapFile string, data interface{}) {
-	w := p.ResponseWriter
-	t := p.engine.templ(yapFile)
-	h := w.Header()
-	h.Set("Content-Type", "text/html")
-	err := t.Execute(w, data)
-	if err != nil {
-		log.Panicln("YAP:", err)
+	p.yap(code, yapFile, "", data)
+}
+
+// YAPBlock is like YAP, but only renders the named block (a template defined
+// by `{{define}}` or `{{block}}`) of yapFile, eg. for htmx fragment responses.
+func (p *Context) YAPBlock(code int, yapFile, block string, data interface{}) {
+	p.yap(code, yapFile, block, data)
+}
+
+func (p *Context) yap(code int, yapFile, block string, data interface{}) {
+	_, span := p.engine.Tracer().Start(p.Request.Context(), "yap.render")
+	defer endSpan(span)
+	span.SetAttr("yap.template", yapFile)
+	if block != "" {
+		span.SetAttr("yap.block", block)
+	}
+	buf := getBuf()
+	defer putBuf(buf)
+	if err := p.engine.execute(buf, yapFile, block, p.layout, p.withLocale(data)); err != nil {
+		span.RecordError(err)
+		p.templateError(err)
+		return
+	}
+	p.DATA(code, "text/html", buf.Bytes())
+}
+
+func (p *Context) templateError(err *TemplateError) {
+	if p.engine.PanicHandler != nil {
+		panic(err)
 	}
+	log.Println(err)
+	code := http.StatusInternalServerError
+	http.Error(p.ResponseWriter, http.StatusText(code), code)
 }
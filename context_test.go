@@ -0,0 +1,239 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package yap
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestYAP(t *testing.T) {
+	e := New(fstest.MapFS{
+		"hello_yap.html": {Data: []byte("<p>{{.Name}}</p>")},
+		"bad_yap.html":   {Data: []byte("<p>\n{{.Name.Foo}}</p>")},
+	})
+	e.GET("/hello", func(ctx *Context) {
+		ctx.YAP(201, "hello", H{"Name": "yap"})
+	})
+	e.GET("/bad", func(ctx *Context) {
+		ctx.YAP(200, "bad", H{"Name": "yap"})
+	})
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest("GET", "/hello", nil))
+	if w.Code != 201 || w.Body.String() != "<p>yap</p>" || w.Header().Get("Content-Length") != "10" {
+		t.Fatal("YAP:", w.Code, w.Body.String(), w.Header())
+	}
+
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest("GET", "/bad", nil))
+	if w.Code != 500 {
+		t.Fatal("YAP error:", w.Code, w.Body.String())
+	}
+
+	var terr *TemplateError
+	e.PanicHandler = func(w http.ResponseWriter, r *http.Request, v interface{}) {
+		terr, _ = v.(*TemplateError)
+		w.WriteHeader(500)
+	}
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/bad", nil))
+	if terr == nil || terr.Name != "bad" || terr.Line != 2 {
+		t.Fatal("TemplateError:", terr)
+	}
+}
+
+func TestLayout(t *testing.T) {
+	e := New(fstest.MapFS{
+		"layouts/base_yap.html": {Data: []byte(`<title>{{block "title" .}}Site{{end}}</title>{{block "content" .}}{{end}}`)},
+		"layouts/blog_yap.html": {Data: []byte(`{{extends "layouts/base"}}{{define "content"}}<article>{{block "body" .}}{{end}}</article>{{end}}`)},
+		"post_yap.html":         {Data: []byte("{{extends `layouts/blog`}}\n{{define \"title\"}}{{.}}{{end}}{{define \"body\"}}Post {{.}}{{end}}")},
+		"about_yap.html":        {Data: []byte(`{{define "content"}}About{{end}}`)},
+		"home_yap.html":         {Data: []byte(`{{define "content"}}Home{{end}}`)},
+	})
+	e.LoadTemplate("*_yap.html", "layouts/*_yap.html")
+	e.SetLayout("layouts/base")
+	e.GET("/post", func(ctx *Context) {
+		ctx.YAP(200, "post", "yap")
+	})
+	e.GET("/about", func(ctx *Context) {
+		ctx.YAP(200, "about", nil)
+	})
+	e.GET("/home", func(ctx *Context) {
+		ctx.YAP(200, "home", nil)
+	}, Layout(""))
+	cases := map[string]string{
+		"/post":  "<title>yap</title><article>Post yap</article>",
+		"/about": "<title>Site</title>About",
+		"/home":  "",
+	}
+	for path, want := range cases {
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Body.String() != want {
+			t.Fatal("Layout:", path, w.Body.String())
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	e := New(fstest.MapFS{
+		"base_yap.html": {Data: []byte(`<main>{{block "content" .}}{{end}}</main>`)},
+		"mail_yap.html": {Data: []byte(`{{extends "base"}}{{define "content"}}Hi {{.}}{{block "row" .}}<i>{{.}}</i>{{end}}{{end}}`)},
+	})
+	if ret, err := e.RenderString("mail", "yap"); err != nil || ret != "<main>Hi yap<i>yap</i></main>" {
+		t.Fatal("RenderString:", ret, err)
+	}
+	var b strings.Builder
+	if err := e.RenderBlock(&b, "mail", "row", "x"); err != nil || b.String() != "<i>x</i>" {
+		t.Fatal("RenderBlock:", b.String(), err)
+	}
+	var terr *TemplateError
+	if _, err := e.RenderString("notfound", nil); !errors.As(err, &terr) {
+		t.Fatal("RenderString:", err)
+	}
+}
+
+func TestDelims(t *testing.T) {
+	e := New(fstest.MapFS{
+		"a_yap.html": {Data: []byte(`{{x}}[[[ .A ]]]`)},
+		"b_yap.html": {Data: []byte("<!-- yap:delims <% %> -->\n{{.A}}<%\n.B\n%>")},
+	})
+	e.SetDelims("[[[", "]]]")
+	ret, err := e.RenderString("a", H{"A": 1})
+	if err != nil || ret != "{{x}}1" {
+		t.Fatal("RenderString a:", ret, err)
+	}
+	ret, err = e.RenderString("b", H{"A": 1, "B": 2})
+	if err != nil || ret != "\n{{.A}}2" {
+		t.Fatal("RenderString b:", ret, err)
+	}
+}
+
+func TestYAPText(t *testing.T) {
+	e := New(fstest.MapFS{
+		"mail_yap.html": {Data: []byte(`<b>{{.}}</b>`)},
+		"mail_yap.txt":  {Data: []byte("Hi {{.}}\n{{\nif true\n}}!{{end}}")},
+	})
+	e.LoadTemplate("*.*")
+	e.GET("/", func(ctx *Context) {
+		ctx.YAPText(200, "mail", "<yap>")
+	})
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Body.String() != "Hi <yap>\n!" || w.Header().Get("Content-Type") != "text/plain; charset=utf-8" {
+		t.Fatal("YAPText:", w.Body.String(), w.Header())
+	}
+	if ret, err := e.RenderString("mail", "<yap>"); err != nil || ret != "<b>&lt;yap&gt;</b>" {
+		t.Fatal("RenderString:", ret, err)
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	e := New(fstest.MapFS{
+		"base_yap.html": {Data: []byte(`<title>{{.Meta.title}}</title>{{block "content" .}}{{end}}`)},
+		"post_yap.md":   {Data: []byte("---\nlayout: base\ntitle: Hello\n---\n# Hi {{.Name}}\n\n| a | b |\n|---|---|\n| 1 | 2 |\n")},
+	})
+	s, err := e.RenderString("post", H{"Name": "yap"})
+	if err != nil {
+		t.Fatal("RenderString:", err)
+	}
+	if !strings.HasPrefix(s, `<title>Hello</title><h1 id="hi-yap">Hi yap</h1>`) || !strings.Contains(s, "<td>1</td>") {
+		t.Fatal("markdown:", s)
+	}
+}
+
+func TestTemplateMeta(t *testing.T) {
+	e := New(fstest.MapFS{
+		"base_yap.html": {Data: []byte(`<title>{{.Meta.title}}</title>{{block "body" .}}{{end}}`)},
+		"page_yap.html": {Data: []byte("---\nlayout: base\ntitle: Page\nauth: true\n---\n{{define \"body\"}}<p>{{.Name}}</p>{{end}}")},
+	})
+	if meta := e.TemplateMeta("page"); meta["auth"] != true || meta["title"] != "Page" {
+		t.Fatal("TemplateMeta:", meta)
+	}
+	s, err := e.RenderString("page", H{"Name": "yap"})
+	if err != nil || s != "<title>Page</title><p>yap</p>" {
+		t.Fatal("RenderString:", s, err)
+	}
+	e = New(fstest.MapFS{
+		"bad_yap.html": {Data: []byte("---\ntitle: Bad\n{{.Name}}")},
+	})
+	if _, err = e.parseTemplates(nil); err == nil || !strings.Contains(err.Error(), "bad_yap.html") {
+		t.Fatal("parseTemplates:", err)
+	}
+}
+
+func TestMetaFunc(t *testing.T) {
+	e := New(fstest.MapFS{
+		"base_yap.html":  {Data: []byte(`<title>{{(meta).title}}</title>{{block "body" .}}{{end}}`)},
+		"page_yap.html":  {Data: []byte("---\nlayout: base\ntitle: Page\n---\n{{define \"body\"}}<p>{{.Name}}</p>{{end}}")},
+		"plain_yap.html": {Data: []byte("---\ntitle: Plain\n---\n{{(meta).title}} {{.Name}}")},
+		"none_yap.html":  {Data: []byte("{{if meta}}meta{{else}}none{{end}}")},
+	})
+	data := struct{ Name string }{"yap"}
+	for name, want := range map[string]string{
+		"page":  "<title>Page</title><p>yap</p>",
+		"plain": "\n\n\nPlain yap",
+		"none":  "none",
+	} {
+		if s, err := e.RenderString(name, data); err != nil || s != want {
+			t.Fatal("RenderString:", name, s, err)
+		}
+	}
+}
+
+func TestFrontMatter(t *testing.T) {
+	meta, rest, err := parseFrontMatter("---\ntitle: Hi # comment\ntags: [go, 'yap']\nn: 3\nempty:\n---\nbody")
+	if err != nil || rest != "\n\n\n\n\n\nbody" || meta["title"] != "Hi" || meta["n"] != 3 || meta["empty"] != "" ||
+		len(meta["tags"].([]any)) != 2 {
+		t.Fatal("parseFrontMatter:", meta, rest, err)
+	}
+	for _, front := range []string{
+		"author:\n  name: yap\n",
+		"tags:\n- go\n- yap\n",
+		"desc: |\n  line 1\n  line 2\n",
+		"desc: >-\n  folded\n",
+		"author: {name: yap}\n",
+		"title: a\n  continued\n",
+	} {
+		if _, _, err = parseFrontMatter("---\n" + front + "---\nbody"); err == nil {
+			t.Fatal("parseFrontMatter: no error for", front)
+		}
+	}
+	for front, want := range map[string]any{
+		"v: false # wip":     false,
+		"v: 3 # x":           3,
+		"v: 1.5 # x":         1.5,
+		`v: "Hi" # c`:        "Hi",
+		`v: "a # b" # c`:     "a # b",
+		`v: "a \" # b" # c`:  `a " # b`,
+		"v: 'it''s # 1' # c": "it's # 1",
+		"v: a#b # c":         "a#b",
+		"v: # empty":         "",
+	} {
+		meta, _, err := parseFrontMatter("---\n" + front + "\n---\nbody")
+		if err != nil || meta["v"] != want {
+			t.Fatal("parseFrontMatter:", front, meta, err)
+		}
+	}
+	meta, _, err = parseFrontMatter("---\ntags: [a, 'b # c'] # c\n---\nbody")
+	if tags, _ := meta["tags"].([]any); err != nil || len(tags) != 2 || tags[1] != "b # c" {
+		t.Fatal("parseFrontMatter: list with a comment:", meta, err)
+	}
+}
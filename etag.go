@@ -0,0 +1,198 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package yap
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	etagNone = iota
+	etagStrong
+	etagWeak
+)
+
+// AutoETag makes DATA, JSON, YAP, etc. of a route compute the ETag of the
+// response body, and answer conditional GET and HEAD requests with 304 Not
+// Modified or 412 Precondition Failed. See Context.AutoETag.
+func AutoETag(weak ...bool) RouteOption {
+	mode := etagMode(weak)
+	return func(opts *routeOptions) {
+		opts.etag = mode
+	}
+}
+
+// AutoETag makes DATA, JSON, YAP, etc. compute the ETag (a weak one if weak
+// is true) of the response body unless the ETag header is already set, and
+// honour If-None-Match, If-Match, If-Modified-Since and If-Unmodified-Since
+// of GET and HEAD requests.
+//
+// Preconditions of other methods (eg. If-Match of PUT) aren't checked
+// automatically, because the response is built after side effects of the
+// handler. Such handlers should set the ETag of the current resource and call
+// CheckPreconditions before making changes.
+func (p *Context) AutoETag(weak ...bool) {
+	p.etag = etagMode(weak)
+}
+
+func etagMode(weak []bool) int {
+	if weak != nil && weak[0] {
+		return etagWeak
+	}
+	return etagStrong
+}
+
+// SetETag sets the ETag header. etag is quoted if it isn't.
+func (p *Context) SetETag(etag string) {
+	if !strings.HasSuffix(etag, `"`) {
+		etag = `"` + etag + `"`
+	}
+	p.ResponseWriter.Header().Set("ETag", etag)
+}
+
+// SetLastModified sets the Last-Modified header.
+func (p *Context) SetLastModified(t time.Time) {
+	if !t.IsZero() {
+		p.ResponseWriter.Header().Set("Last-Modified", t.UTC().Format(http.TimeFormat))
+	}
+}
+
+// SetCacheControl sets the Cache-Control header, eg.
+//
+//	ctx.SetCacheControl("public", "max-age=60")
+func (p *Context) SetCacheControl(directives ...string) {
+	p.ResponseWriter.Header().Set("Cache-Control", strings.Join(directives, ", "))
+}
+
+// CheckPreconditions evaluates conditional request headers against the ETag
+// and Last-Modified headers set by the handler. It answers the request with
+// 304 or 412 and returns true if the precondition says so. Handlers that know
+// the version of a resource can call it to skip building the response:
+//
+//	ctx.SetETag(version)
+//	if ctx.CheckPreconditions() {
+//		return
+//	}
+func (p *Context) CheckPreconditions() (done bool) {
+	code := checkPreconditions(p.Request, p.ResponseWriter.Header())
+	if code == 0 {
+		return false
+	}
+	writeNotModified(p.ResponseWriter, code)
+	return true
+}
+
+// writeETagged writes a 2xx response with an automatic ETag. It reports
+// whether the response is answered by a precondition of a GET or HEAD
+// request.
+func (p *Context) writeETagged(code int, data []byte) bool {
+	if p.etag == etagNone || code < 200 || code >= 300 {
+		return false
+	}
+	h := p.ResponseWriter.Header()
+	if h.Get("ETag") == "" {
+		h.Set("ETag", computeETag(data, p.etag == etagWeak))
+	}
+	if m := p.Request.Method; m != http.MethodGet && m != http.MethodHead {
+		return false
+	}
+	return p.CheckPreconditions()
+}
+
+func computeETag(data []byte, weak bool) string {
+	sum := sha256.Sum256(data)
+	etag := `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+	if weak {
+		etag = "W/" + etag
+	}
+	return etag
+}
+
+func writeNotModified(w http.ResponseWriter, code int) {
+	h := w.Header()
+	delete(h, "Content-Type")
+	delete(h, "Content-Length")
+	if code == http.StatusNotModified {
+		w.WriteHeader(code)
+		return
+	}
+	http.Error(w, http.StatusText(code), code)
+}
+
+// checkPreconditions evaluates preconditions in the order of RFC 9110 13.2.2.
+// It returns 0 if the request should be processed normally.
+func checkPreconditions(req *http.Request, h http.Header) int {
+	etag := h.Get("ETag")
+	lastMod, _ := http.ParseTime(h.Get("Last-Modified"))
+	if im := req.Header.Get("If-Match"); im != "" {
+		if !etagMatch(im, etag, false) {
+			return http.StatusPreconditionFailed
+		}
+	} else if ius, err := http.ParseTime(req.Header.Get("If-Unmodified-Since")); err == nil && !lastMod.IsZero() {
+		if lastMod.After(ius) {
+			return http.StatusPreconditionFailed
+		}
+	}
+	isGet := req.Method == http.MethodGet || req.Method == http.MethodHead
+	if inm := req.Header.Get("If-None-Match"); inm != "" {
+		if etagMatch(inm, etag, true) {
+			if isGet {
+				return http.StatusNotModified
+			}
+			return http.StatusPreconditionFailed
+		}
+	} else if isGet && !lastMod.IsZero() {
+		if ims, err := http.ParseTime(req.Header.Get("If-Modified-Since")); err == nil && !lastMod.After(ims) {
+			return http.StatusNotModified
+		}
+	}
+	return 0
+}
+
+// etagMatch reports whether etag matches one of the entity tags in list.
+// Weak comparison is used for If-None-Match and strong for If-Match.
+func etagMatch(list, etag string, weakCmp bool) bool {
+	if etag == "" {
+		return false
+	}
+	if strings.TrimSpace(list) == "*" {
+		return true
+	}
+	if strings.HasPrefix(etag, "W/") {
+		if !weakCmp {
+			return false
+		}
+		etag = etag[2:]
+	}
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if strings.HasPrefix(item, "W/") {
+			if !weakCmp {
+				continue
+			}
+			item = item[2:]
+		}
+		if item == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package yap
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAutoETag(t *testing.T) {
+	e := New()
+	modTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	e.GET("/p", func(ctx *Context) {
+		ctx.SetLastModified(modTime)
+		ctx.SetCacheControl("public", "max-age=60")
+		ctx.JSON(200, map[string]int{"id": 1})
+	}, AutoETag())
+	version, writes := `"v1"`, 0
+	e.PUT("/p", func(ctx *Context) {
+		ctx.SetETag(version)
+		if ctx.CheckPreconditions() {
+			return
+		}
+		writes++
+		ctx.JSON(200, map[string]int{"id": 1})
+	}, AutoETag(true))
+	e.DELETE("/p", func(ctx *Context) {
+		writes++
+		ctx.JSON(200, map[string]int{"id": 1})
+	}, AutoETag(true))
+
+	do := func(method string, hdr ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/p", nil)
+		for i := 0; i < len(hdr); i += 2 {
+			req.Header.Set(hdr[i], hdr[i+1])
+		}
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, req)
+		return w
+	}
+	w := do("GET")
+	etag := w.Header().Get("ETag")
+	if w.Code != 200 || etag == "" || w.Header().Get("Cache-Control") != "public, max-age=60" {
+		t.Fatal("GET:", w.Code, w.Header())
+	}
+	if w = do("GET", "If-None-Match", `"x", `+etag); w.Code != 304 || w.Body.Len() != 0 || w.Header().Get("ETag") != etag {
+		t.Fatal("If-None-Match:", w.Code, w.Header())
+	}
+	if w = do("GET", "If-Modified-Since", modTime.Format(http.TimeFormat)); w.Code != 304 {
+		t.Fatal("If-Modified-Since:", w.Code)
+	}
+	if w = do("GET", "If-Match", `"x"`); w.Code != 412 {
+		t.Fatal("If-Match:", w.Code)
+	}
+
+	if w = do("PUT", "If-Match", `"v0"`); w.Code != 412 || writes != 0 {
+		t.Fatal("PUT If-Match mismatch:", w.Code, writes)
+	}
+	if w = do("PUT", "If-None-Match", "*"); w.Code != 412 || writes != 0 {
+		t.Fatal("PUT If-None-Match:", w.Code, writes)
+	}
+	if w = do("PUT", "If-Match", `"v1"`); w.Code != 200 || writes != 1 || w.Header().Get("ETag") != `"v1"` {
+		t.Fatal("PUT If-Match:", w.Code, writes, w.Header())
+	}
+	w = do("DELETE", "If-Match", `"x"`) // not checked automatically for unsafe methods
+	if etag = w.Header().Get("ETag"); w.Code != 200 || writes != 2 || etag[:2] != "W/" {
+		t.Fatal("DELETE:", w.Code, writes, etag)
+	}
+}
@@ -0,0 +1,169 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package yap
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const frontMatterDelim = "---"
+
+// parseFrontMatter parses the front matter at the beginning of text, like:
+//
+//	---
+//	title: Hello world
+//	tags: [go, yap]
+//	draft: false
+//	---
+//
+// It supports a subset of YAML: `key: value` lines, where a value can be a
+// string (quoted or not), a number, a bool or an inline list. Nested maps and
+// multi-line values (indented lines, block lists, `|` and `>` scalars) are
+// rejected. `# comments` outside quotes are ignored. The front matter is removed from text, except its newlines.
+func parseFrontMatter(text string) (meta map[string]any, rest string, err error) {
+	front, body, err := splitFrontMatter(text)
+	if err != nil || front == "" {
+		return nil, text, err
+	}
+	lines := strings.Split(strings.TrimSuffix(front, "\n"), "\n")
+	meta = make(map[string]any)
+	for i := 1; i < len(lines)-1; i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if c := lines[i][0]; c == ' ' || c == '\t' || line == "-" || strings.HasPrefix(line, "- ") {
+			return nil, text, fmt.Errorf("front matter: line %d: nested or multi-line values are not supported: %s", i+1, line)
+		}
+		key, val, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, text, fmt.Errorf("front matter: line %d: invalid syntax: %s", i+1, line)
+		}
+		if meta[strings.TrimSpace(key)], err = frontMatterValue(stripComment(val)); err != nil {
+			return nil, text, fmt.Errorf("front matter: line %d: %v", i+1, err)
+		}
+	}
+	return meta, strings.Repeat("\n", len(lines)) + body, nil
+}
+
+// splitFrontMatter splits text into the front matter (with its delimiter
+// lines) and the rest. front is empty if text has no front matter.
+func splitFrontMatter(text string) (front, body string, err error) {
+	s := strings.TrimPrefix(text, "\ufeff")
+	if !strings.HasPrefix(s, frontMatterDelim+"\n") && !strings.HasPrefix(s, frontMatterDelim+"\r\n") {
+		return "", text, nil
+	}
+	pos := strings.IndexByte(s, '\n') + 1
+	for pos < len(s) {
+		n := strings.IndexByte(s[pos:], '\n')
+		end := len(s)
+		if n >= 0 {
+			end = pos + n + 1
+		}
+		if strings.TrimSpace(s[pos:end]) == frontMatterDelim {
+			return s[:end], s[end:], nil
+		}
+		pos = end
+	}
+	return "", text, fmt.Errorf("front matter: missing closing %s", frontMatterDelim)
+}
+
+func frontMatterValue(val string) (any, error) {
+	if val != "" && (val[0] == '|' || val[0] == '>') {
+		return nil, fmt.Errorf("multi-line values are not supported: %s", val)
+	}
+	if strings.HasPrefix(val, "{") {
+		return nil, fmt.Errorf("maps are not supported: %s", val)
+	}
+	if strings.HasPrefix(val, "[") {
+		if !strings.HasSuffix(val, "]") {
+			return nil, fmt.Errorf("invalid list: %s", val)
+		}
+		ret := []any{}
+		for _, item := range strings.Split(val[1:len(val)-1], ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			v, err := frontMatterValue(item)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, v)
+		}
+		return ret, nil
+	}
+	switch {
+	case val == "":
+		return "", nil
+	case val[0] == '"':
+		return strconv.Unquote(val)
+	case val[0] == '\'' && len(val) > 1 && val[len(val)-1] == '\'':
+		return strings.ReplaceAll(val[1:len(val)-1], "''", "'"), nil
+	case val == "true":
+		return true, nil
+	case val == "false":
+		return false, nil
+	}
+	if v, err := strconv.ParseInt(val, 10, 64); err == nil {
+		return int(v), nil
+	}
+	if v, err := strconv.ParseFloat(val, 64); err == nil {
+		return v, nil
+	}
+	return val, nil
+}
+
+// stripComment removes a trailing `# comment` outside quotes from the value
+// val, and trims spaces. A comment starts with a `#` after a space.
+func stripComment(val string) string {
+	var quote byte
+	for i := 0; i < len(val); i++ {
+		switch c := val[i]; {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || val[i-1] == ' ' || val[i-1] == '\t'):
+			return strings.TrimSpace(val[:i])
+		}
+	}
+	return strings.TrimSpace(val)
+}
+
+// Meta returns metadata of the template name declared by its front matter.
+func (t *Template) Meta(name string) map[string]any {
+	if t.lay == nil {
+		return nil
+	}
+	return t.lay.meta[name]
+}
+
+// TemplateMeta returns metadata of the YAP template name declared by its
+// front matter, eg. to check a required permission before rendering it.
+func (p *Engine) TemplateMeta(name string) map[string]any {
+	t, err := p.loadTemplates()
+	if err != nil {
+		return nil
+	}
+	return t.Meta(name)
+}
@@ -0,0 +1,202 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package yap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Funcs adds funcs to the function map of YAP templates. It should be called
+// before templates are loaded, or templates are reloaded when they're used.
+// Funcs with the same names override the builtin helpers:
+//   - now: the current time
+//   - date LAYOUT TIME: formats a time.Time, *time.Time, unix seconds or
+//     RFC3339 string, eg. `{{.Created | date "2006-01-02"}}`
+//   - number DECIMALS NUM: formats a number with thousands separators, eg.
+//     `{{.Price | number 2}}` => 1,234.50
+//   - truncate N STR: truncates a string to n runes with a trailing "…"
+//   - json V: encodes v as JSON, eg. `<script>var data = {{json .}}</script>`
+//   - dict KEY VALUE ...: creates a map[string]any
+//   - list V ...: creates a []any
+//   - safeHTML STR, safeURL STR: marks a string as trusted HTML or URL
+//   - default DEF V: returns def if v is empty, eg. `{{.Title | default "Untitled"}}`
+//   - meta: metadata declared by the front matter of the rendered template,
+//     for any data, eg. `<title>{{(meta).title}}</title>` in a layout
+//
+// t, asset and integrity are provided by the engine too, see Context.T and
+// Assets.
+func (p *Engine) Funcs(funcs template.FuncMap) {
+	if p.funcs == nil {
+		p.funcs = make(template.FuncMap, len(funcs))
+	}
+	for name, fn := range funcs {
+		p.funcs[name] = fn
+	}
+	p.tpls.store((*Template)(nil))
+}
+
+// engineFuncs returns template funcs depending on the engine:
+//   - t LOCALE KEY ARGS...: translates a message, eg.
+//     `{{t .Locale "hello" (dict "name" .Name)}}`. See Context.T
+//   - asset NAME: the fingerprinted URL of a static file. See Assets
+//   - integrity NAME: the Subresource Integrity hash of a static file
+func (p *Engine) engineFuncs() template.FuncMap {
+	return template.FuncMap{
+		"t":         p.T,
+		"asset":     p.AssetURL,
+		"integrity": p.AssetIntegrity,
+	}
+}
+
+var builtinFuncs = template.FuncMap{
+	"now":      time.Now,
+	"date":     dateFunc,
+	"number":   numberFunc,
+	"truncate": truncateFunc,
+	"json":     jsonFunc,
+	"dict":     dictFunc,
+	"list":     listFunc,
+	"safeHTML": func(s string) template.HTML { return template.HTML(s) },
+	"safeURL":  func(s string) template.URL { return template.URL(s) },
+	"default":  defaultFunc,
+	"meta":     noMeta, // bound to the rendered template, see layouts.build
+}
+
+func noMeta() map[string]any {
+	return nil
+}
+
+func dateFunc(layout string, v any) (string, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t.Format(layout), nil
+	case *time.Time:
+		if t == nil {
+			return "", nil
+		}
+		return t.Format(layout), nil
+	case int64:
+		return time.Unix(t, 0).Format(layout), nil
+	case int:
+		return time.Unix(int64(t), 0).Format(layout), nil
+	case string:
+		tm, err := time.Parse(time.RFC3339, t)
+		if err != nil {
+			return "", err
+		}
+		return tm.Format(layout), nil
+	}
+	return "", fmt.Errorf("date: unsupported type %T", v)
+}
+
+func numberFunc(decimals int, v any) (string, error) {
+	var s string
+	switch x := reflect.ValueOf(v); x.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		s = strconv.FormatInt(x.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		s = strconv.FormatUint(x.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		s = strconv.FormatFloat(x.Float(), 'f', decimals, 64)
+	default:
+		return "", fmt.Errorf("number: unsupported type %T", v)
+	}
+	if decimals > 0 && !strings.Contains(s, ".") {
+		s += "." + strings.Repeat("0", decimals)
+	}
+	sign := ""
+	if s[0] == '-' {
+		sign, s = "-", s[1:]
+	}
+	intPart, frac := s, ""
+	if pos := strings.IndexByte(s, '.'); pos >= 0 {
+		intPart, frac = s[:pos], s[pos:]
+	}
+	var b strings.Builder
+	b.WriteString(sign)
+	for i, c := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(c)
+	}
+	b.WriteString(frac)
+	return b.String(), nil
+}
+
+func truncateFunc(n int, s string) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	if n <= 0 {
+		return ""
+	}
+	i := 0
+	for pos := range s {
+		if i == n-1 {
+			return s[:pos] + "…"
+		}
+		i++
+	}
+	return s
+}
+
+func jsonFunc(v any) (template.JS, error) {
+	b, err := json.Marshal(v)
+	return template.JS(b), err
+}
+
+var errDictArgs = errors.New("dict: arguments must be key value pairs with string keys")
+
+func dictFunc(kvs ...any) (map[string]any, error) {
+	if len(kvs)%2 != 0 {
+		return nil, errDictArgs
+	}
+	ret := make(map[string]any, len(kvs)/2)
+	for i := 0; i < len(kvs); i += 2 {
+		key, ok := kvs[i].(string)
+		if !ok {
+			return nil, errDictArgs
+		}
+		ret[key] = kvs[i+1]
+	}
+	return ret, nil
+}
+
+func listFunc(vals ...any) []any {
+	return vals
+}
+
+func defaultFunc(def, v any) any {
+	if v == nil {
+		return def
+	}
+	if rv := reflect.ValueOf(v); rv.IsZero() {
+		return def
+	} else if k := rv.Kind(); (k == reflect.Slice || k == reflect.Map) && rv.Len() == 0 {
+		return def
+	}
+	return v
+}
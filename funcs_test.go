@@ -0,0 +1,44 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package yap
+
+import (
+	"html/template"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestFuncs(t *testing.T) {
+	e := New(fstest.MapFS{
+		"f_yap.html": {Data: []byte(`{{.T | date "2006-01-02"}}|{{.N | number 2}}|{{-1234567 | number 0}}|` +
+			`{{truncate 3 "héllo"}}|{{.Title | default "Untitled"}}|{{(dict "a" 1).a}}|{{len (list 1 2)}}|` +
+			`{{safeHTML "<b>"}}|{{upper "x"}}<script>var v = {{json .N}}</script>`)},
+	})
+	e.Funcs(template.FuncMap{"upper": strings.ToUpper})
+	e.GET("/", func(ctx *Context) {
+		ctx.YAP(200, "f", H{"T": time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), "N": 1234.5})
+	})
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	want := "2024-03-01|1,234.50|-1,234,567|hé…|Untitled|1|2|<b>|X<script>var v = 1234.5</script>"
+	if ret := w.Body.String(); ret != want {
+		t.Fatal("Funcs:", ret)
+	}
+}
@@ -3,9 +3,17 @@ module github.com/goplus/yap
 go 1.18
 
 require (
+	github.com/fsnotify/fsnotify v1.8.0
 	github.com/golang-jwt/jwt/v5 v5.2.0
 	github.com/goplus/gop v1.2.0
 	github.com/qiniu/x v1.13.3
+	github.com/yuin/goldmark v1.6.0
+	golang.org/x/net v0.17.0
 )
 
 require github.com/joho/godotenv v1.5.1
+
+require (
+	golang.org/x/sys v0.16.0 // indirect
+	golang.org/x/text v0.13.0 // indirect
+)
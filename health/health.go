@@ -0,0 +1,74 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package health is a registry of readiness checks shared by yap engines.
+//
+// Packages like ydb register checks of the resources they manage (eg. a
+// database ping) here, and yap's /readyz endpoint runs them along with the
+// checks registered on the engine.
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Check reports whether a resource is healthy. It should return in time when
+// ctx is done.
+type Check = func(ctx context.Context) error
+
+// Entry is a registered readiness check.
+type Entry struct {
+	Check   Check
+	Timeout time.Duration // 0 means the default timeout of the engine
+}
+
+var (
+	checks = make(map[string]Entry)
+	mutex  sync.Mutex
+)
+
+// Register registers a readiness check with an optional timeout (default is
+// yap.DefaultCheckTimeout). It replaces the check with the same name if
+// exists.
+func Register(name string, check Check, timeout ...time.Duration) {
+	e := Entry{Check: check}
+	if timeout != nil {
+		e.Timeout = timeout[0]
+	}
+	mutex.Lock()
+	checks[name] = e
+	mutex.Unlock()
+}
+
+// Unregister removes the readiness check named name.
+func Unregister(name string) {
+	mutex.Lock()
+	delete(checks, name)
+	mutex.Unlock()
+}
+
+// All returns a snapshot of all registered checks.
+func All() map[string]Entry {
+	mutex.Lock()
+	defer mutex.Unlock()
+	ret := make(map[string]Entry, len(checks))
+	for name, e := range checks {
+		ret[name] = e
+	}
+	return ret
+}
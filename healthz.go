@@ -0,0 +1,187 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package yap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/goplus/yap/health"
+)
+
+// DefaultCheckTimeout is the default timeout of a health check.
+const DefaultCheckTimeout = 3 * time.Second
+
+var errShuttingDown = errors.New("shutting down")
+
+type healthCheck struct {
+	name    string
+	check   health.Check
+	timeout time.Duration
+}
+
+type healthz struct {
+	mutex     sync.Mutex
+	live      []healthCheck
+	ready     []healthCheck
+	livePath  string
+	readyPath string
+}
+
+// LiveCheck registers a liveness check served by /healthz (see
+// SetHealthPaths). A liveness check should only fail if the process can't
+// recover without restarting.
+func (p *Engine) LiveCheck(name string, check func(ctx context.Context) error, timeout ...time.Duration) {
+	p.health.mutex.Lock()
+	p.health.live = append(p.health.live, newHealthCheck(name, check, timeout))
+	p.health.mutex.Unlock()
+}
+
+// ReadyCheck registers a readiness check served by /readyz (see
+// SetHealthPaths), eg. to check whether a dependent service is available.
+// Checks registered in package health (eg. database pings of ydb) are
+// readiness checks too.
+func (p *Engine) ReadyCheck(name string, check func(ctx context.Context) error, timeout ...time.Duration) {
+	p.health.mutex.Lock()
+	p.health.ready = append(p.health.ready, newHealthCheck(name, check, timeout))
+	p.health.mutex.Unlock()
+}
+
+func newHealthCheck(name string, check health.Check, timeout []time.Duration) healthCheck {
+	d := DefaultCheckTimeout
+	if timeout != nil && timeout[0] > 0 {
+		d = timeout[0]
+	}
+	return healthCheck{name, check, d}
+}
+
+// SetHealthPaths sets paths of the liveness and readiness endpoints (default
+// is /healthz and /readyz). An empty path disables the endpoint, eg.
+// SetHealthPaths("", "") disables both. Routes registered with the same paths
+// take priority over the endpoints, while handlers of Mux don't.
+func (p *Engine) SetHealthPaths(live, ready string) {
+	p.health.livePath, p.health.readyPath = live, ready
+}
+
+type checkResult struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+type healthResult struct {
+	Status string                  `json:"status"`
+	Checks map[string]*checkResult `json:"checks,omitempty"`
+}
+
+// serveHealth serves the liveness and readiness endpoints. It reports whether
+// req is handled.
+func (p *Engine) serveHealth(w http.ResponseWriter, req *http.Request) bool {
+	h := &p.health
+	if req.URL.Path == "" || (req.Method != http.MethodGet && req.Method != http.MethodHead) {
+		return false
+	}
+	var checks []healthCheck
+	var ready bool
+	switch req.URL.Path {
+	case h.livePath:
+		h.mutex.Lock()
+		checks = append(checks, h.live...)
+		h.mutex.Unlock()
+	case h.readyPath:
+		h.mutex.Lock()
+		checks = append(checks, h.ready...)
+		h.mutex.Unlock()
+		for name, e := range health.All() {
+			checks = append(checks, newHealthCheck(name, e.Check, []time.Duration{e.Timeout}))
+		}
+		ready = true
+	default:
+		return false
+	}
+	ret := runChecks(req.Context(), checks)
+	if ready {
+		select {
+		case <-p.ShuttingDown():
+			ret.fail("shutdown", errShuttingDown, 0)
+		default:
+		}
+	}
+	code := http.StatusOK
+	if ret.Status != "ok" {
+		code = http.StatusServiceUnavailable
+	}
+	msg, _ := json.Marshal(ret)
+	w.Header().Set("Cache-Control", "no-store")
+	p.NewContext(w, req).DATA(code, "application/json", msg)
+	return true
+}
+
+func (p *healthResult) fail(name string, err error, d time.Duration) {
+	p.Status = "fail"
+	p.Checks[name] = &checkResult{Status: "fail", Error: err.Error(), Duration: d.String()}
+}
+
+func runChecks(ctx context.Context, checks []healthCheck) *healthResult {
+	ret := &healthResult{Status: "ok", Checks: make(map[string]*checkResult, len(checks))}
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	wg.Add(len(checks))
+	for _, c := range checks {
+		go func(c healthCheck) {
+			defer wg.Done()
+			start := time.Now()
+			err := runCheck(ctx, c)
+			d := time.Since(start)
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				ret.fail(c.name, err, d)
+			} else {
+				ret.Checks[c.name] = &checkResult{Status: "ok", Duration: d.String()}
+			}
+		}(c)
+	}
+	wg.Wait()
+	return ret
+}
+
+// runCheck runs a check with its timeout. It returns when the timeout expires
+// even if the check doesn't respect ctx.
+func runCheck(ctx context.Context, c healthCheck) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if e := recover(); e != nil {
+				done <- errors.New("check panics")
+			}
+		}()
+		done <- c.check(ctx)
+	}()
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	return
+}
@@ -0,0 +1,150 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package yap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/goplus/yap/health"
+)
+
+func getHealth(t *testing.T, e *Engine, path string) (int, *healthResult) {
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	if w.Code == 404 {
+		return 404, nil
+	}
+	var ret healthResult
+	if err := json.Unmarshal(w.Body.Bytes(), &ret); err != nil {
+		t.Fatal("json.Unmarshal:", err, w.Body.String())
+	}
+	if cc := w.Header().Get("Cache-Control"); cc != "no-store" {
+		t.Fatal("Cache-Control:", cc)
+	}
+	return w.Code, &ret
+}
+
+func TestHealthz(t *testing.T) {
+	e := New()
+	if code, ret := getHealth(t, e, "/healthz"); code != 200 || ret.Status != "ok" || len(ret.Checks) != 0 {
+		t.Fatal("/healthz:", code, ret)
+	}
+
+	e.LiveCheck("ok", func(context.Context) error { return nil })
+	e.ReadyCheck("db", func(context.Context) error { return errors.New("db is down") })
+	e.ReadyCheck("slow", func(ctx context.Context) error {
+		time.Sleep(time.Second) // doesn't respect ctx
+		return nil
+	}, 10*time.Millisecond)
+	e.ReadyCheck("panic", func(context.Context) error { panic("oops") })
+	health.Register("test.cache", func(context.Context) error { return nil })
+	defer health.Unregister("test.cache")
+	health.Register("test.queue", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, 10*time.Millisecond)
+	defer health.Unregister("test.queue")
+
+	if code, ret := getHealth(t, e, "/healthz"); code != 200 || ret.Checks["ok"].Status != "ok" || len(ret.Checks) != 1 {
+		t.Fatal("/healthz:", code, ret)
+	}
+	code, ret := getHealth(t, e, "/readyz")
+	if code != 503 || ret.Status != "fail" || len(ret.Checks) != 5 {
+		t.Fatal("/readyz:", code, ret)
+	}
+	for name, want := range map[string]string{
+		"db":         "db is down",
+		"slow":       context.DeadlineExceeded.Error(),
+		"panic":      "check panics",
+		"test.cache": "",
+		"test.queue": context.DeadlineExceeded.Error(),
+	} {
+		if c := ret.Checks[name]; c == nil || c.Error != want {
+			t.Fatal("/readyz:", name, c)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest("POST", "/healthz", nil))
+	if w.Code != 404 {
+		t.Fatal("POST /healthz:", w.Code)
+	}
+
+	e.SetHealthPaths("", "")
+	for _, path := range []string{"/healthz", "/readyz"} {
+		if code, _ := getHealth(t, e, path); code != 404 {
+			t.Fatal("disabled:", path, code)
+		}
+	}
+}
+
+func TestHealthzRoutes(t *testing.T) {
+	e := New()
+	e.SetHealthPaths("/healthz", "")
+	e.GET("/healthz", func(ctx *Context) {
+		ctx.TEXT(200, "text/plain", "mine")
+	})
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+	if w.Body.String() != "mine" {
+		t.Fatal("route /healthz:", w.Code, w.Body.String())
+	}
+	if code, _ := getHealth(t, e, "/readyz"); code != 404 {
+		t.Fatal("disabled /readyz:", code)
+	}
+}
+
+func TestShutdownDrain(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "app.sock")
+	e := New()
+	e.SetShutdownDrain(200 * time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- e.RunContext(ctx, "unix:"+sock) }()
+
+	c := unixClient(sock)
+	status := func(path string) int {
+		resp, err := c.Get("http://yap" + path)
+		if err != nil {
+			t.Fatal("GET:", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	waitServing(t, c, "http://yap/readyz")
+	if code := status("/readyz"); code != 200 {
+		t.Fatal("/readyz:", code)
+	}
+	cancel()
+	<-e.ShuttingDown()
+	if code := status("/readyz"); code != http.StatusServiceUnavailable {
+		t.Fatal("/readyz while draining:", code)
+	}
+	if code := status("/healthz"); code != 200 {
+		t.Fatal("/healthz while draining:", code)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal("RunContext:", err)
+	}
+}
@@ -0,0 +1,596 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package yap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	defaultLocale       = "en"
+	defaultLocaleCookie = "lang"
+)
+
+// I18nOptions represents options of selecting the locale of a request.
+type I18nOptions struct {
+	// Default is the locale used when no locale of a request is available
+	// (default is "en").
+	Default string
+
+	// Cookie is the name of the cookie specifying the locale (default is
+	// "lang").
+	Cookie string
+
+	// PathPrefix enables selecting the locale by the first segment of the
+	// request path, eg. /zh/about. The prefix is removed before routing.
+	PathPrefix bool
+}
+
+// SetI18nOptions sets options of selecting the locale of a request. The
+// locale of a request is selected from (in order):
+//   - the path prefix, if PathPrefix is enabled
+//   - the cookie
+//   - the Accept-Language header
+//   - the default locale
+func (p *Engine) SetI18nOptions(opts *I18nOptions) {
+	p.i18n.opts = opts
+}
+
+// LoadLocales loads message catalogs from dir (default is "$YapFS/locales").
+// A catalog is a JSON or gettext PO file named by its locale, eg. en.json,
+// zh-CN.po. A JSON catalog maps message keys to messages, or to plural forms
+// of messages:
+//
+//	{
+//		"hello": "Hello, {name}!",
+//		"apples": {"one": "{0} apple", "other": "{0} apples"}
+//	}
+func (p *Engine) LoadLocales(dir ...fs.FS) {
+	var fsys fs.FS
+	if dir != nil {
+		fsys = dir[0]
+	} else {
+		fsys = p.FS("locales")
+	}
+	cats, err := loadCatalogs(fsys)
+	if err != nil {
+		log.Panicln(err)
+	}
+	p.i18n.cats.Store(cats)
+}
+
+// Locales returns the locales of loaded message catalogs.
+func (p *Engine) Locales() []string {
+	cats := p.catalogs()
+	ret := make([]string, 0, len(cats))
+	for locale := range cats {
+		ret = append(ret, locale)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// T translates the message key into locale. See Context.T.
+func (p *Engine) T(locale, key string, args ...any) string {
+	cats := p.catalogs()
+	msg, ok := cats[locale].lookup(locale, key, args)
+	if !ok {
+		def := p.i18n.defaultLocale()
+		if msg, ok = cats[def].lookup(def, key, args); !ok {
+			msg = key
+		}
+	}
+	return interpolate(msg, args)
+}
+
+// Locale returns the locale of the request. See SetI18nOptions.
+func (p *Context) Locale() string {
+	if p.locale == "" {
+		p.locale = p.engine.negotiateLocale(p.Request)
+	}
+	return p.locale
+}
+
+// SetLocale sets the locale of this request.
+func (p *Context) SetLocale(locale string) {
+	p.locale = locale
+}
+
+// T translates the message key into the locale of the request. A message
+// can refer to args by {0}, {1}, ..., or by {name} if an arg is a map, eg.
+// `ctx.T("hello", yap.H{"name": name})`. The first integer arg selects the
+// plural form of the message.
+func (p *Context) T(key string, args ...any) string {
+	return p.engine.T(p.Locale(), key, args...)
+}
+
+// withLocale adds the locale of the request as the Locale field of data if
+// message catalogs are loaded. See withFields.
+func (p *Context) withLocale(data interface{}) interface{} {
+	if len(p.engine.catalogs()) == 0 {
+		return data
+	}
+	return withFields(data, H{"Locale": p.Locale()})
+}
+
+// -----------------------------------------------------------------------------
+
+type i18n struct {
+	opts *I18nOptions
+	cats atomic.Value // map[string]catalog
+	once sync.Once
+}
+
+func (p *i18n) defaultLocale() string {
+	if p.opts != nil && p.opts.Default != "" {
+		return normLocale(p.opts.Default)
+	}
+	return defaultLocale
+}
+
+func (p *i18n) cookie() string {
+	if p.opts != nil && p.opts.Cookie != "" {
+		return p.opts.Cookie
+	}
+	return defaultLocaleCookie
+}
+
+// catalogs returns the loaded message catalogs, loads them from
+// $YapFS/locales if they aren't loaded yet.
+func (p *Engine) catalogs() map[string]catalog {
+	p.i18n.once.Do(func() {
+		if p.i18n.cats.Load() != nil {
+			return
+		}
+		fsys, err := fs.Sub(p.yapFS(), "locales")
+		var cats map[string]catalog
+		if err == nil {
+			cats, err = loadCatalogs(fsys)
+		}
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Println("yap: load locales failed:", err)
+		}
+		p.i18n.cats.Store(cats)
+	})
+	cats, _ := p.i18n.cats.Load().(map[string]catalog)
+	return cats
+}
+
+type localeKey struct{}
+
+// stripLocale removes the locale prefix of the request path, and saves the
+// locale in the request context.
+func (p *Engine) stripLocale(req *http.Request) *http.Request {
+	if p.i18n.opts == nil || !p.i18n.opts.PathPrefix {
+		return req
+	}
+	urlPath := req.URL.Path
+	if len(urlPath) < 2 || urlPath[0] != '/' {
+		return req
+	}
+	seg := urlPath[1:]
+	if pos := strings.IndexByte(seg, '/'); pos >= 0 {
+		seg = seg[:pos]
+	}
+	locale := normLocale(seg)
+	if _, ok := p.catalogs()[locale]; !ok || seg == "" {
+		return req
+	}
+	req = req.WithContext(context.WithValue(req.Context(), localeKey{}, locale))
+	u := *req.URL
+	u.Path = urlPath[len(seg)+1:]
+	if strings.HasPrefix(u.RawPath, "/"+seg) {
+		u.RawPath = u.RawPath[len(seg)+1:]
+	} else {
+		u.RawPath = "" // the prefix is escaped, which is rare
+	}
+	if u.Path == "" {
+		u.Path, u.RawPath = "/", ""
+	}
+	req.URL = &u
+	return req
+}
+
+func (p *Engine) negotiateLocale(req *http.Request) string {
+	if locale, ok := req.Context().Value(localeKey{}).(string); ok {
+		return locale
+	}
+	cats := p.catalogs()
+	if c, err := req.Cookie(p.i18n.cookie()); err == nil {
+		if locale, ok := matchLocale(cats, c.Value); ok {
+			return locale
+		}
+	}
+	for _, tag := range acceptLanguages(req.Header.Get("Accept-Language")) {
+		if locale, ok := matchLocale(cats, tag); ok {
+			return locale
+		}
+	}
+	return p.i18n.defaultLocale()
+}
+
+// matchLocale returns the locale of cats matching tag, eg. "zh-CN" matches
+// "zh-cn", "zh" or "zh-tw" (in order).
+func matchLocale(cats map[string]catalog, tag string) (string, bool) {
+	tag = normLocale(tag)
+	if _, ok := cats[tag]; ok {
+		return tag, true
+	}
+	base := baseLocale(tag)
+	if _, ok := cats[base]; ok {
+		return base, true
+	}
+	var ret string
+	for locale := range cats {
+		if baseLocale(locale) == base && (ret == "" || locale < ret) {
+			ret = locale
+		}
+	}
+	return ret, ret != ""
+}
+
+// acceptLanguages returns language tags of an Accept-Language header in
+// order of preference.
+func acceptLanguages(header string) []string {
+	type lang struct {
+		tag string
+		q   float64
+	}
+	var langs []lang
+	for _, item := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(item), ";")
+		q := 1.0
+		if params = strings.TrimSpace(params); strings.HasPrefix(params, "q=") {
+			q, _ = strconv.ParseFloat(params[2:], 64)
+		}
+		if tag = strings.TrimSpace(tag); tag != "" && tag != "*" && q > 0 {
+			langs = append(langs, lang{tag, q})
+		}
+	}
+	sort.SliceStable(langs, func(i, j int) bool { return langs[i].q > langs[j].q })
+	ret := make([]string, len(langs))
+	for i, l := range langs {
+		ret[i] = l.tag
+	}
+	return ret
+}
+
+func normLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+}
+
+func baseLocale(locale string) string {
+	if pos := strings.IndexByte(locale, '-'); pos >= 0 {
+		return locale[:pos]
+	}
+	return locale
+}
+
+// -----------------------------------------------------------------------------
+
+// catalog maps message keys to plural forms of messages. A message without
+// plural forms is stored as the "other" form.
+type catalog map[string]map[string]string
+
+func (c catalog) lookup(locale, key string, args []any) (string, bool) {
+	forms, ok := c[key]
+	if !ok {
+		return "", false
+	}
+	if n, ok := pluralCount(args); ok {
+		if msg, ok := forms[pluralRule(locale)(n)]; ok {
+			return msg, true
+		}
+	}
+	msg, ok := forms["other"]
+	return msg, ok
+}
+
+func loadCatalogs(fsys fs.FS) (map[string]catalog, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	cats := make(map[string]catalog)
+	for _, e := range entries {
+		name := e.Name()
+		ext := path.Ext(name)
+		if e.IsDir() || (ext != ".json" && ext != ".po") {
+			continue
+		}
+		b, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		locale := normLocale(strings.TrimSuffix(name, ext))
+		var c catalog
+		if ext == ".json" {
+			c, err = parseJSONCatalog(b)
+		} else {
+			c, err = parsePOCatalog(b, pluralForms(locale))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("yap: locale %s: %v", name, err)
+		}
+		if old, ok := cats[locale]; ok {
+			for k, v := range c {
+				old[k] = v
+			}
+		} else {
+			cats[locale] = c
+		}
+	}
+	return cats, nil
+}
+
+func parseJSONCatalog(b []byte) (catalog, error) {
+	var msgs map[string]json.RawMessage
+	if err := json.Unmarshal(b, &msgs); err != nil {
+		return nil, err
+	}
+	c := make(catalog, len(msgs))
+	for key, raw := range msgs {
+		var msg string
+		if json.Unmarshal(raw, &msg) == nil {
+			c[key] = map[string]string{"other": msg}
+			continue
+		}
+		var forms map[string]string
+		if err := json.Unmarshal(raw, &forms); err != nil {
+			return nil, fmt.Errorf("message %s: must be a string or plural forms", key)
+		}
+		c[key] = forms
+	}
+	return c, nil
+}
+
+// parsePOCatalog parses a gettext PO file. msgstr[i] of a plural message is
+// mapped to forms[i].
+func parsePOCatalog(b []byte, forms []string) (catalog, error) {
+	c := make(catalog)
+	var id, field string
+	var idx int
+	var fuzzy bool
+	strs := map[int]string{}
+	flush := func() {
+		if id != "" && !fuzzy {
+			msg := make(map[string]string, len(strs))
+			for i, s := range strs {
+				if s == "" {
+					continue
+				}
+				if i < len(forms) {
+					msg[forms[i]] = s
+				}
+				if i == len(strs)-1 {
+					msg["other"] = s
+				}
+			}
+			if len(msg) > 0 {
+				c[id] = msg
+			}
+		}
+		id, field, fuzzy = "", "", false
+		strs = map[int]string{}
+	}
+	for i, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "#"):
+			if field == "msgstr" { // comments of the next entry
+				flush()
+			}
+			if strings.HasPrefix(line, "#,") && strings.Contains(line, "fuzzy") {
+				fuzzy = true
+			}
+			continue
+		case line[0] == '"':
+			s, err := strconv.Unquote(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", i+1, err)
+			}
+			switch field {
+			case "msgid":
+				id += s
+			case "msgstr":
+				strs[idx] += s
+			}
+			continue
+		}
+		kw, val, _ := strings.Cut(line, " ")
+		s, err := strconv.Unquote(strings.TrimSpace(val))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		switch {
+		case kw == "msgctxt":
+			if field == "msgstr" {
+				flush()
+			}
+			field = kw
+		case kw == "msgid":
+			if field == "msgstr" {
+				flush()
+			}
+			id, field = s, kw
+		case kw == "msgid_plural":
+			field = kw
+		case kw == "msgstr":
+			idx, field = 0, kw
+			strs[0] = s
+		case strings.HasPrefix(kw, "msgstr[") && strings.HasSuffix(kw, "]"):
+			if idx, err = strconv.Atoi(kw[7 : len(kw)-1]); err != nil {
+				return nil, fmt.Errorf("line %d: invalid keyword %s", i+1, kw)
+			}
+			field = "msgstr"
+			strs[idx] = s
+		default:
+			return nil, fmt.Errorf("line %d: invalid keyword %s", i+1, kw)
+		}
+	}
+	flush()
+	return c, nil
+}
+
+// -----------------------------------------------------------------------------
+
+// pluralRule returns the CLDR plural rule of integers of locale.
+func pluralRule(locale string) func(n int) string {
+	switch baseLocale(locale) {
+	case "zh", "ja", "ko", "vi", "th", "id", "ms":
+		return func(n int) string { return "other" }
+	case "fr":
+		return func(n int) string {
+			if n == 0 || n == 1 {
+				return "one"
+			}
+			return "other"
+		}
+	case "ru", "uk", "be":
+		return func(n int) string {
+			switch n10, n100 := n%10, n%100; {
+			case n10 == 1 && n100 != 11:
+				return "one"
+			case n10 >= 2 && n10 <= 4 && (n100 < 12 || n100 > 14):
+				return "few"
+			}
+			return "many"
+		}
+	case "pl":
+		return func(n int) string {
+			switch n10, n100 := n%10, n%100; {
+			case n == 1:
+				return "one"
+			case n10 >= 2 && n10 <= 4 && (n100 < 12 || n100 > 14):
+				return "few"
+			}
+			return "many"
+		}
+	case "cs", "sk":
+		return func(n int) string {
+			switch {
+			case n == 1:
+				return "one"
+			case n >= 2 && n <= 4:
+				return "few"
+			}
+			return "other"
+		}
+	}
+	return func(n int) string {
+		if n == 1 {
+			return "one"
+		}
+		return "other"
+	}
+}
+
+// pluralForms returns plural forms of locale in the order of gettext
+// msgstr[i].
+func pluralForms(locale string) []string {
+	switch baseLocale(locale) {
+	case "zh", "ja", "ko", "vi", "th", "id", "ms":
+		return []string{"other"}
+	case "ru", "uk", "be", "pl":
+		return []string{"one", "few", "many"}
+	case "cs", "sk":
+		return []string{"one", "few", "other"}
+	}
+	return []string{"one", "other"}
+}
+
+func pluralCount(args []any) (int, bool) {
+	for _, arg := range args {
+		switch v := reflect.ValueOf(arg); v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return int(v.Int()), true
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return int(v.Uint()), true
+		}
+	}
+	return 0, false
+}
+
+// interpolate replaces {0}, {1}, ... of msg with args, and {name} with the
+// value of a map arg.
+func interpolate(msg string, args []any) string {
+	if len(args) == 0 || !strings.Contains(msg, "{") {
+		return msg
+	}
+	var b strings.Builder
+	for {
+		pos := strings.IndexByte(msg, '{')
+		if pos < 0 {
+			break
+		}
+		n := strings.IndexByte(msg[pos:], '}')
+		if n < 0 {
+			break
+		}
+		b.WriteString(msg[:pos])
+		name := msg[pos+1 : pos+n]
+		if v, ok := interpolateArg(name, args); ok {
+			fmt.Fprint(&b, v)
+		} else {
+			b.WriteString(msg[pos : pos+n+1])
+		}
+		msg = msg[pos+n+1:]
+	}
+	b.WriteString(msg)
+	return b.String()
+}
+
+func interpolateArg(name string, args []any) (any, bool) {
+	if i, err := strconv.Atoi(name); err == nil {
+		if i >= 0 && i < len(args) {
+			return args[i], true
+		}
+		return nil, false
+	}
+	for _, arg := range args {
+		switch m := arg.(type) {
+		case H:
+			if v, ok := m[name]; ok {
+				return v, true
+			}
+		case map[string]any:
+			if v, ok := m[name]; ok {
+				return v, true
+			}
+		case map[string]string:
+			if v, ok := m[name]; ok {
+				return v, true
+			}
+		}
+	}
+	return nil, false
+}
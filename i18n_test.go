@@ -0,0 +1,174 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package yap
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+const poRu = `msgid ""
+msgstr ""
+"Plural-Forms: nplurals=3; plural=(n%10==1 && n%100!=11 ? 0 : n%10>=2 && n%10<=4 && (n%100<10 || n%100>=20) ? 1 : 2);\n"
+
+msgid "hello"
+msgstr "Привет, {name}!"
+
+msgid "apple"
+msgid_plural "apples"
+msgstr[0] "{0} яблоко"
+msgstr[1] "{0} "
+"яблока"
+msgstr[2] "{0} яблок"
+
+#, fuzzy
+msgid "bye"
+msgstr "Пока"
+`
+
+func TestI18n(t *testing.T) {
+	e := New(fstest.MapFS{
+		"locales/en.json": {Data: []byte(`{
+			"hello": "Hello, {name}!",
+			"bye": "Bye",
+			"apples": {"one": "{0} apple", "other": "{0} apples"}
+		}`)},
+		"locales/zh-CN.json": {Data: []byte(`{"hello": "你好，{name}！", "apples": "{0} 个苹果"}`)},
+		"locales/ru.po":      {Data: []byte(poRu)},
+		"hello_yap.html":     {Data: []byte(`{{t .Locale "hello" .}}`)},
+	})
+	e.SetI18nOptions(&I18nOptions{PathPrefix: true})
+	e.GET("/hello", func(ctx *Context) {
+		ctx.YAP(200, "hello", H{"name": "yap"})
+	})
+	e.GET("/apples", func(ctx *Context) {
+		ctx.TEXT(200, "text/plain", ctx.T("apples", 3))
+	})
+
+	get := func(url string, header ...string) string {
+		req := httptest.NewRequest("GET", url, nil)
+		for i := 0; i < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, req)
+		if w.Code != 200 {
+			t.Fatal(url, w.Code)
+		}
+		return w.Body.String()
+	}
+	if s := get("/hello"); s != "Hello, yap!" {
+		t.Fatal("default:", s)
+	}
+	if s := get("/hello", "Accept-Language", "fr;q=0.9, zh-TW;q=0.8, en;q=0.5"); s != "你好，yap！" {
+		t.Fatal("Accept-Language:", s)
+	}
+	if s := get("/hello", "Accept-Language", "zh", "Cookie", "lang=ru"); s != "Привет, yap!" {
+		t.Fatal("cookie:", s)
+	}
+	if s := get("/zh-cn/hello", "Cookie", "lang=ru"); s != "你好，yap！" {
+		t.Fatal("path prefix:", s)
+	}
+	if s := get("/en/apples", "Accept-Language", "ru"); s != "3 apples" {
+		t.Fatal("plural:", s)
+	}
+	if s := get("/ru/apples"); s != "3 apples" { // falls back to the default locale
+		t.Fatal("fallback:", s)
+	}
+
+	for n, want := range map[int]string{1: "1 яблоко", 3: "3 яблока", 11: "11 яблок", 21: "21 яблоко"} {
+		if s := e.T("ru", "apple", n); s != want {
+			t.Fatal("ru plural:", n, s)
+		}
+	}
+	if s := e.T("en", "apples", 1); s != "1 apple" {
+		t.Fatal("en plural:", s)
+	}
+	if s := e.T("ru", "bye"); s != "Bye" { // fuzzy entries are ignored
+		t.Fatal("fuzzy:", s)
+	}
+
+	req := httptest.NewRequest("GET", "/xx/hello", nil)
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Fatal("unknown prefix:", w.Code)
+	}
+}
+
+func TestStripLocale(t *testing.T) {
+	e := New(fstest.MapFS{
+		"locales/en.json":    {Data: []byte(`{"hello": "Hello"}`)},
+		"locales/zh-CN.json": {Data: []byte(`{"hello": "你好"}`)},
+	})
+	e.SetI18nOptions(&I18nOptions{PathPrefix: true})
+	for _, c := range []struct{ url, path, rawPath string }{
+		{"/zh-cn/files/a%2Fb", "/files/a/b", "/files/a%2Fb"},
+		{"/zh-cn", "/", ""},
+		{"/en/", "/", ""},
+		{"/files/a%2Fb", "/files/a/b", "/files/a%2Fb"},
+	} {
+		req := e.stripLocale(httptest.NewRequest("GET", c.url, nil))
+		if req.URL.Path != c.path || req.URL.RawPath != c.rawPath {
+			t.Fatal("stripLocale:", c.url, "=>", req.URL.Path, req.URL.RawPath)
+		}
+	}
+	req := httptest.NewRequest("OPTIONS", "/", nil)
+	req.URL.Path = ""
+	if ret := e.stripLocale(req); ret != req {
+		t.Fatal("stripLocale: empty path")
+	}
+}
+
+type localeData struct {
+	Name   string
+	Locale string
+}
+
+func (p *localeData) Greeting() string {
+	return "Hi " + p.Name
+}
+
+func TestLocaleStruct(t *testing.T) {
+	e := New(fstest.MapFS{
+		"locales/en.json":    {Data: []byte(`{"hello": "Hello"}`)},
+		"locales/zh-CN.json": {Data: []byte(`{"hello": "你好"}`)},
+		"hello_yap.html":     {Data: []byte(`{{t .Locale "hello"}} {{.Greeting}}`)},
+	})
+	data := &localeData{Name: "yap"}
+	e.GET("/hello", func(ctx *Context) {
+		ctx.YAP(200, "hello", data)
+	})
+	e.GET("/fixed", func(ctx *Context) {
+		ctx.YAP(200, "hello", &localeData{Name: "yap", Locale: "en"})
+	})
+	get := func(url string) string {
+		req := httptest.NewRequest("GET", url, nil)
+		req.Header.Set("Accept-Language", "zh-CN")
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+	if s := get("/hello"); s != "你好 Hi yap" || data.Locale != "" {
+		t.Fatal("struct data:", s, data.Locale)
+	}
+	if s := get("/fixed"); s != "Hello Hi yap" {
+		t.Fatal("struct data with Locale:", s)
+	}
+}
@@ -28,7 +28,7 @@ func Translate(text, left, right string) string {
 		if pos < 0 {
 			break
 		}
-		begin := base + pos + 2 // script begin
+		begin := base + pos + len(left) // script begin
 		n := strings.Index(text[begin:], right)
 		if n < 0 {
 			n = len(text) - begin // script length
@@ -54,7 +54,7 @@ func Translate(text, left, right string) string {
 		return text
 	}
 	var b strings.Builder
-	b.Grow(len(text) + n*4)
+	b.Grow(len(text) + n*(len(left)+len(right)))
 	base = 0
 	for i := 0; i < n; i++ {
 		off := offs[i]
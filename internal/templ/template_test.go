@@ -16,7 +16,10 @@
 
 package templ
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 const yapScriptIn = `
 <html>
@@ -101,3 +104,17 @@ efg
 		t.Fatal("translate(noScriptEnd):", ret)
 	}
 }
+
+func TestTranslateDelims(t *testing.T) {
+	in := strings.NewReplacer("{{", "[[[", "}}", "]]]").Replace(yapScriptIn)
+	out := strings.NewReplacer("{{", "[[[", "}}", "]]]").Replace(yapScriptOut)
+	if ret := Translate(in, "[[[", "]]]"); ret != out {
+		t.Fatal("TestTranslateDelims:", ret)
+	}
+	if ret := Translate("<%\nif .A\n%>", "<%", "%>"); ret != "<%\nif .A\n%>" {
+		t.Fatal("TestTranslateDelims:", ret)
+	}
+	if n := testing.AllocsPerRun(10, func() { Translate(in, "[[[", "]]]") }); n != 1 {
+		t.Fatal("TestTranslateDelims: allocs", n)
+	}
+}
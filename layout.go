@@ -0,0 +1,188 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package yap
+
+import (
+	"fmt"
+	"html/template"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// SetLayout sets the default layout of YAP templates, eg. "layouts/base".
+// A template that declares its layout by `{{extends "layout"}}` isn't
+// affected. See Layout.
+func (p *Engine) SetLayout(layout string) {
+	p.layout = layout
+}
+
+// SetLayout sets the layout used by YAP of this request. An empty layout
+// means no layout.
+func (p *Context) SetLayout(layout string) {
+	p.layout = layout
+}
+
+// Layout sets the layout of YAP templates rendered by a route. An empty
+// layout means no layout.
+//
+// A layout is a template that renders blocks (`{{block "name" .}}default
+// content{{end}}`) which can be overridden by `{{define "name"}}` of a page.
+// A page can declare its layout by starting with `{{extends "layout"}}`, and
+// layouts can be nested.
+func Layout(layout string) RouteOption {
+	return func(opts *routeOptions) {
+		opts.layout, opts.hasLayout = layout, true
+	}
+}
+
+func layoutHandle(handle func(ctx *Context), layout string) func(ctx *Context) {
+	return func(ctx *Context) {
+		ctx.layout = layout
+		handle(ctx)
+	}
+}
+
+// -----------------------------------------------------------------------------
+
+type layoutSrc struct {
+	text   string // source without directives
+	delims Delims
+}
+
+type layouts struct {
+	srcs    map[string]layoutSrc      // template => source
+	extends map[string]string         // page => layout declared by extends
+	master  *template.Template        // never executed, for cloning
+	meta    map[string]map[string]any // template => front matter
+
+	mutex sync.Mutex
+	cache map[string]*template.Template // page + layout => template
+}
+
+func newLayouts() *layouts {
+	return &layouts{
+		srcs:    make(map[string]layoutSrc),
+		extends: make(map[string]string),
+		meta:    make(map[string]map[string]any),
+		cache:   make(map[string]*template.Template),
+	}
+}
+
+func (p *layouts) add(name, layout, text string, delims Delims) {
+	p.srcs[name] = layoutSrc{text, delims}
+	if layout != "" {
+		p.extends[name] = layout
+	}
+}
+
+func (p *layouts) init(t *Template) (err error) {
+	p.master, err = t.Template.Clone()
+	return
+}
+
+// extendsOf extracts the `{{extends "layout"}}` directive at the beginning of
+// text. Lines of the directive are kept to keep line numbers of errors.
+func extendsOf(text string, delims Delims) (layout, rest string) {
+	re, err := regexp.Compile(`^\s*` + regexp.QuoteMeta(delims.Left) +
+		`-?\s*extends\s+("(?:[^"\\]|\\.)*"|` + "`[^`]*`" + `)\s*-?` + regexp.QuoteMeta(delims.Right))
+	if err != nil {
+		return "", text
+	}
+	m := re.FindStringSubmatch(text)
+	if m == nil {
+		return "", text
+	}
+	if layout, err = strconv.Unquote(m[1]); err != nil {
+		return "", text
+	}
+	return layout, strings.Repeat("\n", strings.Count(m[0], "\n")) + text[len(m[0]):]
+}
+
+// LookupLayout returns the template name rendered with layout. The layout
+// declared by `{{extends "layout"}}` of the template takes priority.
+func (t *Template) LookupLayout(name, layout string) (*template.Template, error) {
+	p := t.lay
+	if p == nil {
+		return t.Lookup(name), nil
+	}
+	if l, ok := p.extends[name]; ok {
+		layout = l
+	}
+	if layout == name {
+		layout = ""
+	}
+	if layout == "" && p.meta[name] == nil {
+		return t.Lookup(name), nil
+	}
+	if _, ok := p.srcs[name]; !ok {
+		return nil, nil
+	}
+	key := name + "\x00" + layout
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if ret, ok := p.cache[key]; ok {
+		return ret, nil
+	}
+	ret, err := p.build(name, layout)
+	if err != nil {
+		return nil, err
+	}
+	p.cache[key] = ret
+	return ret, nil
+}
+
+// build clones the master templates, and then parses the page and its
+// layouts from the innermost one, so blocks defined by a page override the
+// ones of its layouts. The meta func of the clone returns the front matter of
+// the page.
+func (p *layouts) build(name, layout string) (*template.Template, error) {
+	chain := []string{name}
+	for layout != "" {
+		for _, v := range chain {
+			if v == layout {
+				return nil, fmt.Errorf("yap: layout cycle: %s => %s", strings.Join(chain, " => "), layout)
+			}
+		}
+		chain = append(chain, layout)
+		layout = p.extends[layout]
+	}
+	root := chain[len(chain)-1]
+	if p.master.Lookup(root) == nil {
+		return nil, fmt.Errorf("yap: layout %s not found", root)
+	}
+	set, err := p.master.Clone()
+	if err != nil {
+		return nil, err
+	}
+	if meta := p.meta[name]; meta != nil {
+		set.Funcs(template.FuncMap{"meta": func() map[string]any { return meta }})
+	}
+	for i := len(chain) - 2; i >= 0; i-- {
+		page, parent := chain[i], chain[i+1]
+		src := p.srcs[page]
+		if _, err = (Template{Template: set.New(page), delims: src.delims}).Parse(src.text); err != nil {
+			return nil, err
+		}
+		body := "{{template " + strconv.Quote(parent) + " .}}"
+		if _, err = set.New(page).Delims("{{", "}}").Parse(body); err != nil {
+			return nil, err
+		}
+	}
+	return set.Lookup(name), nil
+}
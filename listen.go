@@ -0,0 +1,180 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package yap
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Listen adds a listener that Run/RunTLS serves along with the main address.
+// If prefixes are specified, the listener only serves requests whose paths
+// are under one of them, and the main listener doesn't serve these paths. A
+// prefix matches on path segments, eg. "/metrics" matches "/metrics" and
+// "/metrics/foo", but not "/metricsfoo". For example:
+//
+//	y.Listen(":9090", "/metrics", "/debug/") // internal admin port
+//	y.Listen("unix:/run/app.sock")           // the whole app on a unix socket
+//
+// See Run for the supported address formats.
+func (p *Engine) Listen(addr string, prefixes ...string) {
+	p.listeners = append(p.listeners, extraListener{addr, prefixes})
+}
+
+type extraListener struct {
+	addr     string
+	prefixes []string
+}
+
+// listenExtra listens on addresses added by Listen, and returns the handler
+// of the main listener.
+func (p *Engine) listenExtra(h http.Handler) (main http.Handler, svrs []server, err error) {
+	var excluded []string
+	for _, l := range p.listeners {
+		ln, e := listen(l.addr)
+		if e != nil {
+			closeListeners(svrs)
+			return nil, nil, e
+		}
+		debugPrint("Listening and serving HTTP on %s %v\n", l.addr, l.prefixes)
+		eh := h
+		if l.prefixes != nil {
+			eh = onlyPrefixes(h, l.prefixes)
+			excluded = append(excluded, l.prefixes...)
+		}
+		svrs = append(svrs, p.plainServer(ln, eh))
+	}
+	if excluded != nil {
+		h = exceptPrefixes(h, excluded)
+	}
+	return h, svrs, nil
+}
+
+// hasPrefix reports whether path is under one of the prefixes, matching on
+// path segments.
+func hasPrefix(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(path, prefix) &&
+			(len(path) == len(prefix) || strings.HasSuffix(prefix, "/") || path[len(prefix)] == '/') {
+			return true
+		}
+	}
+	return false
+}
+
+func onlyPrefixes(h http.Handler, prefixes []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hasPrefix(r.URL.Path, prefixes) {
+			h.ServeHTTP(w, r)
+		} else {
+			http.NotFound(w, r)
+		}
+	})
+}
+
+func exceptPrefixes(h http.Handler, prefixes []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hasPrefix(r.URL.Path, prefixes) {
+			http.NotFound(w, r)
+		} else {
+			h.ServeHTTP(w, r)
+		}
+	})
+}
+
+// -----------------------------------------------------------------------------
+
+// listen announces on a network address:
+//   - unix:<path>: a unix domain socket (stale socket file is removed)
+//   - fd:<n>: an inherited file descriptor
+//   - systemd[:<name>]: a file descriptor passed by systemd socket activation
+//     (the first one, or the one named by FileDescriptorName=)
+//   - otherwise: a TCP network address, eg. ":8080"
+func listen(addr string) (net.Listener, error) {
+	switch {
+	case strings.HasPrefix(addr, "unix:"):
+		return listenUnix(addr[5:])
+	case strings.HasPrefix(addr, "fd:"):
+		fd, err := strconv.Atoi(addr[3:])
+		if err != nil || fd < 0 {
+			return nil, fmt.Errorf("yap: invalid address %q", addr)
+		}
+		return fileListener(fd, addr)
+	case addr == "systemd" || strings.HasPrefix(addr, "systemd:"):
+		fd, err := systemdFd(strings.TrimPrefix(addr[7:], ":"))
+		if err != nil {
+			return nil, err
+		}
+		return fileListener(fd, addr)
+	}
+	return net.Listen("tcp", addr)
+}
+
+func listenUnix(path string) (net.Listener, error) {
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		conn, err := net.Dial("unix", path)
+		if err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("yap: unix socket %s is in use", path)
+		}
+		if errors.Is(err, syscall.ECONNREFUSED) {
+			os.Remove(path) // stale socket of a previous process
+		}
+	}
+	return net.Listen("unix", path)
+}
+
+func fileListener(fd int, name string) (net.Listener, error) {
+	f := os.NewFile(uintptr(fd), name)
+	if f == nil {
+		return nil, fmt.Errorf("yap: invalid file descriptor %d", fd)
+	}
+	defer f.Close()
+	return net.FileListener(f)
+}
+
+const systemdFirstFd = 3
+
+var errNoSystemdFds = errors.New("yap: no file descriptor passed by systemd")
+
+// systemdFd returns the file descriptor passed by systemd socket activation.
+// See sd_listen_fds(3) for more information.
+func systemdFd(name string) (int, error) {
+	if pid := os.Getenv("LISTEN_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0, errNoSystemdFds
+	}
+	n, _ := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if n <= 0 {
+		return 0, errNoSystemdFds
+	}
+	if name == "" {
+		return systemdFirstFd, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	for i := 0; i < n && i < len(names); i++ {
+		if names[i] == name {
+			return systemdFirstFd + i, nil
+		}
+	}
+	return 0, fmt.Errorf("yap: no file descriptor named %q passed by systemd", name)
+}
@@ -0,0 +1,157 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package yap
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestListenUnix(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "app.sock")
+	ln, err := listen("unix:" + sock)
+	if err != nil {
+		t.Fatal("listen:", err)
+	}
+	if _, err = listen("unix:" + sock); err == nil {
+		t.Fatal("listen: no error for a socket in use")
+	}
+
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+	if _, err = os.Stat(sock); err != nil {
+		t.Fatal("stale socket:", err)
+	}
+	if ln, err = listen("unix:" + sock); err != nil {
+		t.Fatal("listen on a stale socket:", err)
+	}
+	ln.Close()
+
+	file := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(file, nil, 0600)
+	if _, err = listen("unix:" + file); err == nil {
+		t.Fatal("listen: no error for a regular file")
+	}
+	if _, err = os.Stat(file); err != nil {
+		t.Fatal("regular file is removed:", err)
+	}
+}
+
+func TestSystemdFd(t *testing.T) {
+	t.Setenv("LISTEN_PID", "")
+	t.Setenv("LISTEN_FDS", "")
+	t.Setenv("LISTEN_FDNAMES", "")
+	if _, err := listen("systemd"); err != errNoSystemdFds {
+		t.Fatal("listen systemd without fds:", err)
+	}
+
+	t.Setenv("LISTEN_FDS", "2")
+	t.Setenv("LISTEN_FDNAMES", "http:admin")
+	for name, want := range map[string]int{"": 3, "http": 3, "admin": 4} {
+		if fd, err := systemdFd(name); err != nil || fd != want {
+			t.Fatal("systemdFd:", name, fd, err)
+		}
+	}
+	if _, err := systemdFd("metrics"); err == nil {
+		t.Fatal("systemdFd: no error for an unknown name")
+	}
+	if _, err := listen("systemd:metrics"); err == nil {
+		t.Fatal("listen: no error for an unknown name")
+	}
+
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+	if _, err := systemdFd(""); err != errNoSystemdFds {
+		t.Fatal("systemdFd of another process:", err)
+	}
+}
+
+func TestListenPrefixes(t *testing.T) {
+	dir := t.TempDir()
+	mainSock, adminSock := filepath.Join(dir, "main.sock"), filepath.Join(dir, "admin.sock")
+	e := New()
+	e.GET("/", func(ctx *Context) {
+		ctx.TEXT(200, "text/plain", "home")
+	})
+	e.GET("/metrics", func(ctx *Context) {
+		ctx.TEXT(200, "text/plain", "metrics")
+	})
+	e.GET("/metrics-dashboard", func(ctx *Context) {
+		ctx.TEXT(200, "text/plain", "dashboard")
+	})
+	e.Listen("unix:"+adminSock, "/metrics")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- e.RunContext(ctx, "unix:"+mainSock) }()
+	defer func() {
+		cancel()
+		if err := <-errc; err != nil {
+			t.Fatal("RunContext:", err)
+		}
+	}()
+
+	get := func(sock, path string) (int, string) {
+		resp, err := unixClient(sock).Get("http://yap" + path)
+		if err != nil {
+			t.Fatal("GET:", err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(b)
+	}
+	waitServing(t, unixClient(mainSock), "http://yap/")
+	waitServing(t, unixClient(adminSock), "http://yap/metrics")
+	if code, body := get(mainSock, "/"); code != 200 || body != "home" {
+		t.Fatal("main /:", code, body)
+	}
+	if code, _ := get(mainSock, "/metrics"); code != 404 {
+		t.Fatal("main /metrics:", code)
+	}
+	if code, body := get(mainSock, "/metrics-dashboard"); code != 200 || body != "dashboard" {
+		t.Fatal("main /metrics-dashboard:", code, body)
+	}
+	if code, body := get(adminSock, "/metrics"); code != 200 || body != "metrics" {
+		t.Fatal("admin /metrics:", code, body)
+	}
+	if code, _ := get(adminSock, "/"); code != 404 {
+		t.Fatal("admin /:", code)
+	}
+}
+
+func TestHasPrefix(t *testing.T) {
+	prefixes := []string{"/metrics", "/debug/"}
+	for path, want := range map[string]bool{
+		"/metrics":           true,
+		"/metrics/":          true,
+		"/metrics/go":        true,
+		"/metrics-dashboard": false,
+		"/metricsfoo":        false,
+		"/debug/pprof":       true,
+		"/debug/":            true,
+		"/debug":             false,
+		"/":                  false,
+	} {
+		if hasPrefix(path, prefixes) != want {
+			t.Fatal("hasPrefix:", path, !want)
+		}
+	}
+}
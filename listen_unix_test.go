@@ -0,0 +1,75 @@
+//go:build !windows
+// +build !windows
+
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package yap
+
+import (
+	"io"
+	"net"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+func TestListenFd(t *testing.T) {
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcp.Close()
+	f, err := tcp.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	dup, err := syscall.Dup(int(f.Fd())) // to be closed by listen
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := listen("fd:" + strconv.Itoa(dup))
+	if err != nil {
+		t.Fatal("listen:", err)
+	}
+	defer ln.Close()
+	if ln.Addr().String() != tcp.Addr().String() {
+		t.Fatal("fd listener:", ln.Addr(), tcp.Addr())
+	}
+	go func() {
+		if conn, err := net.Dial("tcp", tcp.Addr().String()); err == nil {
+			conn.Write([]byte("hi"))
+			conn.Close()
+		}
+	}()
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal("Accept:", err)
+	}
+	b, _ := io.ReadAll(conn)
+	conn.Close()
+	if string(b) != "hi" {
+		t.Fatal("Accept:", string(b))
+	}
+
+	for _, addr := range []string{"fd:", "fd:x", "fd:-1"} {
+		if _, err = listen(addr); err == nil {
+			t.Fatal("listen: no error for", addr)
+		}
+	}
+}
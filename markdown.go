@@ -0,0 +1,169 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package yap
+
+import (
+	"bytes"
+	"io/fs"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer/html"
+)
+
+// mdSuffix is the suffix of Markdown templates.
+const mdSuffix = "_yap.md"
+
+var markdown = goldmark.New(
+	goldmark.WithExtensions(extension.Table),
+	goldmark.WithParserOptions(parser.WithAutoHeadingID()),
+	goldmark.WithRendererOptions(html.WithUnsafe()),
+)
+
+func isMarkdownFile(file string) bool {
+	return strings.HasSuffix(file, mdSuffix)
+}
+
+type mdEntry struct {
+	modTime time.Time
+	size    int64
+	src     string
+}
+
+// mdCache caches Markdown templates converted to HTML templates, keyed by
+// file and its modification time.
+type mdCache struct {
+	mutex   sync.Mutex
+	entries map[string]*mdEntry
+}
+
+// readMarkdown reads a Markdown template file, and converts it to a HTML
+// template. Template actions and the front matter are kept as is. If the
+// front matter specifies a layout, the converted HTML is the "content" block
+// of the layout.
+func (p *Engine) readMarkdown(fsys fs.FS, file string, delims Delims) (src string, err error) {
+	fi, err := fs.Stat(fsys, file)
+	if err != nil {
+		return
+	}
+	c := &p.md
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if e, ok := c.entries[file]; ok && e.modTime.Equal(fi.ModTime()) && e.size == fi.Size() {
+		return e.src, nil
+	}
+	b, err := fs.ReadFile(fsys, file)
+	if err != nil {
+		return
+	}
+	d, text := fileDelims(string(b), delims)
+	front, text, err := splitFrontMatter(text)
+	if err != nil {
+		return
+	}
+	meta, _, err := parseFrontMatter(front)
+	if err != nil {
+		return
+	}
+	text, actions := protectActions(text, d)
+	var buf bytes.Buffer
+	if err = markdown.Convert([]byte(text), &buf); err != nil {
+		return
+	}
+	body := restoreActions(buf.String(), actions)
+
+	var sb strings.Builder
+	if d != delims {
+		sb.WriteString("<!-- yap:delims " + d.Left + " " + d.Right + " -->")
+	}
+	sb.WriteString(front)
+	if layout, ok := meta["layout"].(string); ok && layout != "" {
+		sb.WriteString(d.Left + `define "content"` + d.Right + body + d.Left + "end" + d.Right)
+	} else {
+		sb.WriteString(body)
+	}
+	src = sb.String()
+	if c.entries == nil {
+		c.entries = make(map[string]*mdEntry)
+	}
+	c.entries[file] = &mdEntry{fi.ModTime(), fi.Size(), src}
+	return
+}
+
+const actionMark = "yapaction"
+
+// protectActions replaces template actions with placeholders, so they aren't
+// changed by Markdown conversion.
+func protectActions(text string, delims Delims) (string, []string) {
+	var actions []string
+	var b strings.Builder
+	for {
+		pos := strings.Index(text, delims.Left)
+		if pos < 0 {
+			break
+		}
+		n := strings.Index(text[pos+len(delims.Left):], delims.Right)
+		if n < 0 {
+			break
+		}
+		end := pos + len(delims.Left) + n + len(delims.Right)
+		b.WriteString(text[:pos])
+		b.WriteString(actionMark + strconv.Itoa(len(actions)) + "x")
+		actions = append(actions, text[pos:end])
+		text = text[end:]
+	}
+	if actions == nil {
+		return text, nil
+	}
+	b.WriteString(text)
+	return b.String(), actions
+}
+
+func restoreActions(text string, actions []string) string {
+	if actions == nil {
+		return text
+	}
+	var b strings.Builder
+	for {
+		pos := strings.Index(text, actionMark)
+		if pos < 0 {
+			break
+		}
+		b.WriteString(text[:pos])
+		text = text[pos+len(actionMark):]
+		if n := strings.IndexByte(text, 'x'); n > 0 {
+			if i, err := strconv.Atoi(text[:n]); err == nil && i < len(actions) {
+				b.WriteString(actions[i])
+				text = text[n+1:]
+				continue
+			}
+		}
+		b.WriteString(actionMark)
+	}
+	b.WriteString(text)
+	return b.String()
+}
+
+func markdownName(file string) string {
+	return strings.TrimSuffix(filepath.ToSlash(file), mdSuffix)
+}
@@ -1,15 +1,26 @@
 package noredirect
 
 import (
+	"errors"
+	"fmt"
 	"io"
+	"io/fs"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/textproto"
+	"path"
+	"strconv"
 	"strings"
 	"time"
-	_ "unsafe"
 )
 
 // FileServer returns a handler that serves HTTP requests
 // with the contents of the file system rooted at root.
+//
+// Unlike http.FileServer, it never redirects, so it suits remote
+// http.FileSystem backends whose paths don't follow local conventions.
+// A directory is served by its index.html if there is, and isn't listed.
 func FileServer(root http.FileSystem) http.Handler {
 	return &fileHandler{root}
 }
@@ -24,40 +35,59 @@ func (f *fileHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		upath = "/" + upath
 		r.URL.Path = upath
 	}
-	serveFile(w, r, f.root, upath)
+	serveFile(w, r, f.root, path.Clean(upath))
 }
 
-//go:linkname serveContent net/http.serveContent
-func serveContent(w http.ResponseWriter, r *http.Request, name string, modtime time.Time, sizeFunc func() (int64, error), content io.ReadSeeker)
-
-//go:linkname toHTTPError net/http.toHTTPError
-func toHTTPError(err error) (msg string, httpStatus int)
+const indexPage = "/index.html"
 
 // name is '/'-separated, not filepath.Separator.
-func serveFile(w http.ResponseWriter, r *http.Request, fs http.FileSystem, name string) {
-	f, err := fs.Open(name)
+func serveFile(w http.ResponseWriter, r *http.Request, fsys http.FileSystem, name string) {
+	f, err := fsys.Open(name)
 	if err != nil {
-		msg, code := toHTTPError(err)
-		http.Error(w, msg, code)
+		serveError(w, err)
 		return
 	}
 	defer f.Close()
 
 	d, err := f.Stat()
 	if err != nil {
-		msg, code := toHTTPError(err)
-		http.Error(w, msg, code)
+		serveError(w, err)
 		return
 	}
+	if d.IsDir() {
+		index := strings.TrimSuffix(name, "/") + indexPage
+		ff, err := fsys.Open(index)
+		if err != nil {
+			serveError(w, fs.ErrNotExist)
+			return
+		}
+		defer ff.Close()
+		if d, err = ff.Stat(); err != nil || d.IsDir() {
+			serveError(w, fs.ErrNotExist)
+			return
+		}
+		f = ff
+	}
 
-	// serveContent will check modification time
-	sizeFunc := func() (int64, error) {
-		if size := d.Size(); size >= 0 {
-			return size, nil
+	size := d.Size()
+	if size < 0 {
+		if size, err = fileSize(f); err != nil {
+			serveError(w, err)
+			return
 		}
-		return fileSize(f)
 	}
-	serveContent(w, r, d.Name(), d.ModTime(), sizeFunc, f)
+	serveContent(w, r, d.Name(), d.ModTime(), size, f)
+}
+
+func serveError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		code = http.StatusNotFound
+	case errors.Is(err, fs.ErrPermission):
+		code = http.StatusForbidden
+	}
+	http.Error(w, strconv.Itoa(code)+" "+http.StatusText(code), code)
 }
 
 func fileSize(content http.File) (size int64, err error) {
@@ -71,3 +101,314 @@ func fileSize(content http.File) (size int64, err error) {
 	}
 	return size, nil
 }
+
+// -----------------------------------------------------------------------------
+
+const sniffLen = 512
+
+// serveContent serves content with support of conditional requests, Range
+// requests and HEAD requests.
+func serveContent(w http.ResponseWriter, r *http.Request, name string, modtime time.Time, size int64, content io.ReadSeeker) {
+	h := w.Header()
+	if !isZeroTime(modtime) {
+		h.Set("Last-Modified", modtime.UTC().Format(http.TimeFormat))
+		// files without modtime (eg. embedded ones) can't be versioned by it
+		if h.Get("Etag") == "" {
+			h.Set("Etag", fmt.Sprintf(`"%x-%x"`, modtime.UnixNano(), size))
+		}
+	}
+	if code := checkPreconditions(r, h, modtime); code != 0 {
+		writeNotModified(w, code)
+		return
+	}
+
+	if h.Get("Content-Type") == "" {
+		ctype := mime.TypeByExtension(path.Ext(name))
+		if ctype == "" {
+			var buf [sniffLen]byte
+			n, _ := io.ReadFull(content, buf[:])
+			ctype = http.DetectContentType(buf[:n])
+			if _, err := content.Seek(0, io.SeekStart); err != nil {
+				http.Error(w, "seeker can't seek", http.StatusInternalServerError)
+				return
+			}
+		}
+		h.Set("Content-Type", ctype)
+	}
+	h.Set("Accept-Ranges", "bytes")
+
+	code := http.StatusOK
+	sendSize := size
+	var sendContent io.Reader = content
+	rangeReq := r.Header.Get("Range")
+	if rangeReq != "" && !checkIfRange(r, h, modtime) {
+		rangeReq = ""
+	}
+	if rangeReq != "" && size >= 0 {
+		ranges, err := parseRange(rangeReq, size)
+		if err != nil {
+			h.Set("Content-Range", "bytes */"+strconv.FormatInt(size, 10))
+			http.Error(w, err.Error(), http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		if sumRangesSize(ranges) > size {
+			// The total number of bytes in all the ranges is larger than the
+			// size of the file, serve the whole file instead.
+			ranges = nil
+		}
+		switch {
+		case len(ranges) == 1:
+			ra := ranges[0]
+			if _, err := content.Seek(ra.start, io.SeekStart); err != nil {
+				http.Error(w, err.Error(), http.StatusRequestedRangeNotSatisfiable)
+				return
+			}
+			sendSize = ra.length
+			code = http.StatusPartialContent
+			h.Set("Content-Range", ra.contentRange(size))
+		case len(ranges) > 1:
+			ctype := h.Get("Content-Type")
+			sendSize = rangesMIMESize(ranges, ctype, size)
+			code = http.StatusPartialContent
+
+			pr, pw := io.Pipe()
+			mw := multipart.NewWriter(pw)
+			h.Set("Content-Type", "multipart/byteranges; boundary="+mw.Boundary())
+			sendContent = pr
+			defer pr.Close() // cause writing goroutine to fail and exit if CopyN doesn't finish.
+			go func() {
+				for _, ra := range ranges {
+					part, err := mw.CreatePart(ra.mimeHeader(ctype, size))
+					if err != nil {
+						pw.CloseWithError(err)
+						return
+					}
+					if _, err := content.Seek(ra.start, io.SeekStart); err != nil {
+						pw.CloseWithError(err)
+						return
+					}
+					if _, err := io.CopyN(part, content, ra.length); err != nil {
+						pw.CloseWithError(err)
+						return
+					}
+				}
+				mw.Close()
+				pw.Close()
+			}()
+		}
+	}
+	if h.Get("Content-Encoding") == "" {
+		h.Set("Content-Length", strconv.FormatInt(sendSize, 10))
+	}
+	w.WriteHeader(code)
+	if r.Method != http.MethodHead {
+		io.CopyN(w, sendContent, sendSize)
+	}
+}
+
+func isZeroTime(t time.Time) bool {
+	return t.IsZero() || t.Equal(time.Unix(0, 0))
+}
+
+// checkPreconditions evaluates conditional headers in the order of RFC 9110,
+// section 13.2.2. It returns 304, 412 or 0 if the request should proceed.
+func checkPreconditions(r *http.Request, h http.Header, modtime time.Time) int {
+	etag := h.Get("Etag")
+	if im := r.Header.Get("If-Match"); im != "" {
+		if !etagMatch(im, etag, false) {
+			return http.StatusPreconditionFailed
+		}
+	} else if ius := r.Header.Get("If-Unmodified-Since"); ius != "" && !isZeroTime(modtime) {
+		if t, err := http.ParseTime(ius); err == nil && modtime.Truncate(time.Second).After(t) {
+			return http.StatusPreconditionFailed
+		}
+	}
+	get := r.Method == http.MethodGet || r.Method == http.MethodHead
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if etagMatch(inm, etag, true) {
+			if get {
+				return http.StatusNotModified
+			}
+			return http.StatusPreconditionFailed
+		}
+	} else if ims := r.Header.Get("If-Modified-Since"); ims != "" && get && !isZeroTime(modtime) {
+		if t, err := http.ParseTime(ims); err == nil && !modtime.Truncate(time.Second).After(t) {
+			return http.StatusNotModified
+		}
+	}
+	return 0
+}
+
+// checkIfRange reports whether a Range request should be served partially.
+func checkIfRange(r *http.Request, h http.Header, modtime time.Time) bool {
+	ir := r.Header.Get("If-Range")
+	if ir == "" {
+		return true
+	}
+	if strings.HasPrefix(ir, `"`) || strings.HasPrefix(ir, "W/") {
+		return etagMatch(ir, h.Get("Etag"), false)
+	}
+	if isZeroTime(modtime) {
+		return false
+	}
+	t, err := http.ParseTime(ir)
+	return err == nil && t.Unix() == modtime.Unix()
+}
+
+// etagMatch reports whether etag matches an entity tag of list. The weak
+// comparison ignores W/ prefixes, and the strong one requires both tags to be
+// strong.
+func etagMatch(list, etag string, weak bool) bool {
+	if etag == "" {
+		return false
+	}
+	for _, tag := range strings.Split(list, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if weak {
+			if strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		} else if tag == etag && !strings.HasPrefix(tag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+func writeNotModified(w http.ResponseWriter, code int) {
+	h := w.Header()
+	delete(h, "Content-Type")
+	delete(h, "Content-Length")
+	delete(h, "Content-Encoding")
+	if code == http.StatusNotModified {
+		if h.Get("Etag") != "" {
+			delete(h, "Last-Modified")
+		}
+		w.WriteHeader(code)
+		return
+	}
+	http.Error(w, http.StatusText(code), code)
+}
+
+// -----------------------------------------------------------------------------
+
+// httpRange specifies the byte range to be sent to the client.
+type httpRange struct {
+	start, length int64
+}
+
+func (r httpRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.start, r.start+r.length-1, size)
+}
+
+func (r httpRange) mimeHeader(contentType string, size int64) textproto.MIMEHeader {
+	return textproto.MIMEHeader{
+		"Content-Range": {r.contentRange(size)},
+		"Content-Type":  {contentType},
+	}
+}
+
+var errNoOverlap = errors.New("invalid range: failed to overlap")
+
+// parseRange parses a Range header string as per RFC 7233. errNoOverlap is
+// returned if none of the ranges overlap.
+func parseRange(s string, size int64) ([]httpRange, error) {
+	const b = "bytes="
+	if !strings.HasPrefix(s, b) {
+		return nil, errors.New("invalid range")
+	}
+	var ranges []httpRange
+	noOverlap := false
+	for _, ra := range strings.Split(s[len(b):], ",") {
+		ra = textproto.TrimString(ra)
+		if ra == "" {
+			continue
+		}
+		start, end, ok := strings.Cut(ra, "-")
+		if !ok {
+			return nil, errors.New("invalid range")
+		}
+		start, end = textproto.TrimString(start), textproto.TrimString(end)
+		var r httpRange
+		if start == "" {
+			// If no start is specified, end specifies the range start
+			// relative to the end of the file, and we are dealing with
+			// <suffix-length> which has to be a non-negative integer.
+			if end == "" || end[0] == '-' {
+				return nil, errors.New("invalid range")
+			}
+			i, err := strconv.ParseInt(end, 10, 64)
+			if i < 0 || err != nil {
+				return nil, errors.New("invalid range")
+			}
+			if i > size {
+				i = size
+			}
+			r.start = size - i
+			r.length = size - r.start
+		} else {
+			i, err := strconv.ParseInt(start, 10, 64)
+			if err != nil || i < 0 {
+				return nil, errors.New("invalid range")
+			}
+			if i >= size {
+				// If the range begins after the size of the content,
+				// then it does not overlap.
+				noOverlap = true
+				continue
+			}
+			r.start = i
+			if end == "" {
+				// If no end is specified, range extends to end of the file.
+				r.length = size - r.start
+			} else {
+				i, err := strconv.ParseInt(end, 10, 64)
+				if err != nil || r.start > i {
+					return nil, errors.New("invalid range")
+				}
+				if i >= size {
+					i = size - 1
+				}
+				r.length = i - r.start + 1
+			}
+		}
+		ranges = append(ranges, r)
+	}
+	if noOverlap && len(ranges) == 0 {
+		// The specified ranges did not overlap with the content.
+		return nil, errNoOverlap
+	}
+	return ranges, nil
+}
+
+// countingWriter counts how many bytes have been written to it.
+type countingWriter int64
+
+func (w *countingWriter) Write(p []byte) (n int, err error) {
+	*w += countingWriter(len(p))
+	return len(p), nil
+}
+
+// rangesMIMESize returns the number of bytes it takes to encode the
+// provided ranges as a multipart response.
+func rangesMIMESize(ranges []httpRange, contentType string, contentSize int64) (encSize int64) {
+	var w countingWriter
+	mw := multipart.NewWriter(&w)
+	for _, ra := range ranges {
+		mw.CreatePart(ra.mimeHeader(contentType, contentSize))
+		encSize += ra.length
+	}
+	mw.Close()
+	encSize += int64(w)
+	return
+}
+
+func sumRangesSize(ranges []httpRange) (size int64) {
+	for _, ra := range ranges {
+		size += ra.length
+	}
+	return
+}
@@ -0,0 +1,123 @@
+package noredirect
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestFileServer(t *testing.T) {
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	h := FileServer(http.FS(fstest.MapFS{
+		"hello.txt":       {Data: []byte("0123456789"), ModTime: modTime},
+		"data":            {Data: []byte("<html><body>hi</body></html>"), ModTime: modTime},
+		"dir/index.html":  {Data: []byte("index"), ModTime: modTime},
+		"empty/readme.md": {Data: []byte("readme"), ModTime: modTime},
+	}))
+	serve := func(method, url string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, nil)
+		for i := 0; i < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve("GET", "/hello.txt")
+	etag := w.Header().Get("Etag")
+	if w.Code != 200 || w.Body.String() != "0123456789" || etag == "" ||
+		w.Header().Get("Content-Type") != "text/plain; charset=utf-8" || w.Header().Get("Accept-Ranges") != "bytes" {
+		t.Fatal("GET:", w.Code, w.Body.String(), w.Header())
+	}
+	if w = serve("HEAD", "/hello.txt"); w.Code != 200 || w.Body.Len() != 0 || w.Header().Get("Content-Length") != "10" {
+		t.Fatal("HEAD:", w.Code, w.Body.String(), w.Header())
+	}
+	if w = serve("GET", "/data"); w.Header().Get("Content-Type") != "text/html; charset=utf-8" {
+		t.Fatal("sniffing:", w.Header())
+	}
+	if w = serve("GET", "/hello.txt", "If-None-Match", etag); w.Code != 304 {
+		t.Fatal("If-None-Match:", w.Code)
+	}
+	if w = serve("GET", "/hello.txt", "If-Modified-Since", modTime.Format(http.TimeFormat)); w.Code != 304 {
+		t.Fatal("If-Modified-Since:", w.Code)
+	}
+
+	w = serve("GET", "/hello.txt", "Range", "bytes=2-4")
+	if w.Code != 206 || w.Body.String() != "234" || w.Header().Get("Content-Range") != "bytes 2-4/10" {
+		t.Fatal("Range:", w.Code, w.Body.String(), w.Header())
+	}
+	if w = serve("GET", "/hello.txt", "Range", "bytes=-3"); w.Code != 206 || w.Body.String() != "789" {
+		t.Fatal("suffix Range:", w.Code, w.Body.String())
+	}
+	if w = serve("GET", "/hello.txt", "Range", "bytes=20-"); w.Code != 416 || w.Header().Get("Content-Range") != "bytes */10" {
+		t.Fatal("unsatisfiable Range:", w.Code, w.Header())
+	}
+	if w = serve("GET", "/hello.txt", "Range", "bytes=2-4", "If-Range", etag); w.Code != 206 {
+		t.Fatal("If-Range match:", w.Code)
+	}
+	if w = serve("GET", "/hello.txt", "Range", "bytes=2-4", "If-Range", `"old"`); w.Code != 200 || w.Body.Len() != 10 {
+		t.Fatal("If-Range mismatch:", w.Code)
+	}
+
+	w = serve("GET", "/hello.txt", "Range", "bytes=0-1,5-6")
+	mt, params, _ := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	if w.Code != 206 || mt != "multipart/byteranges" || w.Header().Get("Content-Length") != strconv.Itoa(w.Body.Len()) {
+		t.Fatal("multi Range:", w.Code, w.Header())
+	}
+	mr := multipart.NewReader(w.Body, params["boundary"])
+	var parts []string
+	for {
+		p, err := mr.NextPart()
+		if err != nil {
+			break
+		}
+		b, _ := io.ReadAll(p)
+		parts = append(parts, p.Header.Get("Content-Range")+":"+string(b))
+	}
+	if strings.Join(parts, ";") != "bytes 0-1/10:01;bytes 5-6/10:56" {
+		t.Fatal("multi Range parts:", parts)
+	}
+
+	if w = serve("GET", "/dir/"); w.Code != 200 || w.Body.String() != "index" {
+		t.Fatal("index:", w.Code, w.Body.String())
+	}
+	if w = serve("GET", "/dir/index.html"); w.Code != 200 || w.Body.String() != "index" {
+		t.Fatal("no redirect:", w.Code, w.Header())
+	}
+	if w = serve("GET", "/empty"); w.Code != 404 {
+		t.Fatal("no listing:", w.Code)
+	}
+	if w = serve("GET", "/missing"); w.Code != 404 {
+		t.Fatal("not found:", w.Code)
+	}
+}
+
+func TestZeroModTime(t *testing.T) {
+	fsys := fstest.MapFS{"a.txt": {Data: []byte("v1")}}
+	h := FileServer(http.FS(fsys))
+	serve := func(header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/a.txt", nil)
+		for i := 0; i < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+	w := serve()
+	if w.Code != 200 || w.Header().Get("Etag") != "" || w.Header().Get("Last-Modified") != "" {
+		t.Fatal("zero modtime:", w.Code, w.Header())
+	}
+	fsys["a.txt"] = &fstest.MapFile{Data: []byte("v2")} // same size, still zero modtime
+	if w = serve("If-None-Match", `"0-2"`); w.Code != 200 || w.Body.String() != "v2" {
+		t.Fatal("If-None-Match:", w.Code, w.Body.String())
+	}
+}
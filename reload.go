@@ -0,0 +1,200 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package yap
+
+import (
+	"hash/fnv"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	// templatePollInterval is the interval of checking changes of templates
+	// in a file system that can't be watched.
+	templatePollInterval = time.Second
+
+	// templateReloadDelay is the delay of reloading templates after files are
+	// changed, to coalesce a burst of changes.
+	templateReloadDelay = 100 * time.Millisecond
+)
+
+// templates holds the current template set, which is swapped atomically when
+// templates are reloaded.
+type templates struct {
+	tpl   atomic.Value // *Template
+	mutex sync.Mutex
+	watch sync.Once
+}
+
+func (p *templates) load() *Template {
+	t, _ := p.tpl.Load().(*Template)
+	return t
+}
+
+func (p *templates) store(t *Template) {
+	p.tpl.Store(t)
+}
+
+// loadTemplates returns the current templates, loads them if they aren't
+// loaded yet. If parsing fails, the error is returned and loading is retried
+// next time.
+func (p *Engine) loadTemplates() (*Template, error) {
+	t := p.tpls.load()
+	if t == nil {
+		var err error
+		if t, err = p.initTemplates(); err != nil {
+			return nil, err
+		}
+	}
+	if IsDebugMode {
+		p.tpls.watch.Do(p.watchTemplates)
+	}
+	return t, nil
+}
+
+func (p *Engine) initTemplates() (*Template, error) {
+	p.tpls.mutex.Lock()
+	defer p.tpls.mutex.Unlock()
+	if t := p.tpls.load(); t != nil {
+		return t, nil
+	}
+	t, err := p.parseTemplates(p.tempaltePattern)
+	if err != nil {
+		return nil, err
+	}
+	p.tpls.store(t)
+	return t, nil
+}
+
+// reloadTemplates reparses templates. The last good templates are kept if
+// parsing fails.
+func (p *Engine) reloadTemplates() {
+	p.tpls.mutex.Lock()
+	defer p.tpls.mutex.Unlock()
+	t, err := p.parseTemplates(p.tempaltePattern)
+	if err != nil {
+		log.Println("yap: reload templates failed:", err)
+		return
+	}
+	p.tpls.store(t)
+	log.Println("yap: templates reloaded")
+}
+
+func (p *Engine) watchTemplates() {
+	fsys := p.yapFS()
+	if p.fsDir != "" {
+		err := p.watchDir(p.fsDir)
+		if err == nil {
+			return
+		}
+		log.Println("yap: watch templates failed:", err)
+	}
+	go p.pollTemplates(fsys, fsStamp(fsys))
+}
+
+// watchDir watches dir and its subdirectories by fsnotify.
+func (p *Engine) watchDir(dir string) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && d.IsDir() {
+			err = w.Add(path)
+		}
+		return err
+	})
+	if err != nil {
+		w.Close()
+		return err
+	}
+	go func() {
+		defer w.Close()
+		var timer <-chan time.Time
+		for {
+			select {
+			case ev, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				if ev.Has(fsnotify.Create) {
+					if fi, e := os.Stat(ev.Name); e == nil && fi.IsDir() {
+						w.Add(ev.Name)
+					}
+				}
+				if timer == nil {
+					timer = time.After(templateReloadDelay)
+				}
+			case err, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+				log.Println("yap: watch templates:", err)
+			case <-timer:
+				timer = nil
+				p.reloadTemplates()
+			case <-p.ShuttingDown():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// pollTemplates checks changes of files in fsys periodically, for file
+// systems that can't be watched.
+func (p *Engine) pollTemplates(fsys fs.FS, last uint64) {
+	ticker := time.NewTicker(templatePollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if stamp := fsStamp(fsys); stamp != last {
+				last = stamp
+				p.reloadTemplates()
+			}
+		case <-p.ShuttingDown():
+			return
+		}
+	}
+}
+
+// fsStamp returns a hash of names, sizes and modification times of files in
+// fsys.
+func fsStamp(fsys fs.FS) uint64 {
+	h := fnv.New64a()
+	fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if fi, e := d.Info(); e == nil {
+			h.Write([]byte(path))
+			h.Write([]byte(strconv.FormatInt(fi.Size(), 10)))
+			h.Write([]byte(strconv.FormatInt(fi.ModTime().UnixNano(), 10)))
+		}
+		return nil
+	})
+	return h.Sum64()
+}
@@ -0,0 +1,138 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package yap
+
+import (
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestLoadTemplatesError(t *testing.T) {
+	fsys := fstest.MapFS{
+		"hello_yap.html": {Data: []byte("<p>{{.Name</p>")},
+	}
+	e := New(fsys)
+	e.GET("/hello", func(ctx *Context) {
+		ctx.YAP(200, "hello", H{"Name": "yap"})
+	})
+	serve := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			e.ServeHTTP(w, httptest.NewRequest("GET", "/hello", nil))
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("request hangs")
+		}
+		return w
+	}
+	for i := 0; i < 2; i++ {
+		if w := serve(); w.Code != 500 {
+			t.Fatal("parse error:", i, w.Code, w.Body.String())
+		}
+	}
+	var terr *TemplateError
+	if _, err := e.RenderString("hello", nil); !errors.As(err, &terr) || terr.Name != "hello" || terr.Line != 1 {
+		t.Fatal("RenderString:", err)
+	}
+	if meta := e.TemplateMeta("hello"); meta != nil {
+		t.Fatal("TemplateMeta:", meta)
+	}
+
+	fsys["hello_yap.html"] = &fstest.MapFile{Data: []byte("<p>{{.Name}}</p>")}
+	if w := serve(); w.Code != 200 || w.Body.String() != "<p>yap</p>" {
+		t.Fatal("retry:", w.Code, w.Body.String())
+	}
+}
+
+func TestReloadTemplates(t *testing.T) {
+	fsys := fstest.MapFS{
+		"hello_yap.html": {Data: []byte("v1"), ModTime: time.Unix(1, 0)},
+	}
+	e := New(fsys)
+	render := func() string {
+		s, err := e.RenderString("hello", nil)
+		if err != nil {
+			t.Fatal("RenderString:", err)
+		}
+		return s
+	}
+	if s := render(); s != "v1" {
+		t.Fatal("load:", s)
+	}
+	stamp := fsStamp(fsys)
+
+	fsys["hello_yap.html"] = &fstest.MapFile{Data: []byte("v2"), ModTime: time.Unix(2, 0)}
+	if fsStamp(fsys) == stamp {
+		t.Fatal("fsStamp: change isn't detected")
+	}
+	e.reloadTemplates()
+	if s := render(); s != "v2" {
+		t.Fatal("reload:", s)
+	}
+
+	fsys["hello_yap.html"] = &fstest.MapFile{Data: []byte("{{.Name"), ModTime: time.Unix(3, 0)}
+	e.reloadTemplates()
+	if s := render(); s != "v2" {
+		t.Fatal("keep the last good templates:", s)
+	}
+}
+
+func TestWatchTemplates(t *testing.T) {
+	debug := IsDebugMode
+	IsDebugMode = true
+	defer func() { IsDebugMode = debug }()
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "yap", "hello_yap.html")
+	os.Mkdir(filepath.Dir(file), 0755)
+	os.WriteFile(file, []byte("v1"), 0644)
+	if e := New(os.DirFS(dir)); e.fsDir != "" {
+		t.Fatal("fsDir of os.DirFS:", e.fsDir)
+	}
+	e := New(DirFS(dir))
+	if e.fsDir != filepath.Join(dir, "yap") {
+		t.Fatal("fsDir:", e.fsDir)
+	}
+	defer close(e.graceful.closingChan()) // stops watching
+
+	waitRender := func(want string) {
+		var s string
+		for i := 0; i < 200; i++ {
+			if s, _ = e.RenderString("hello", nil); s == want {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatal("RenderString:", s, "want:", want)
+	}
+	waitRender("v1")
+	os.WriteFile(file, []byte("v2"), 0644)
+	waitRender("v2")
+
+	os.WriteFile(file, []byte("{{.Name"), 0644)
+	time.Sleep(3 * templateReloadDelay)
+	waitRender("v2")
+}
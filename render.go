@@ -0,0 +1,352 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package yap
+
+import (
+	"encoding"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	mimeJson   = "application/json"
+	mimeXml    = "application/xml"
+	mimeCsv    = "text/csv"
+	mimeNdjson = "application/x-ndjson"
+)
+
+func (p *Context) XML(code int, data interface{}) {
+	msg, err := xml.Marshal(data)
+	if err != nil {
+		panic(err)
+	}
+	p.DATA(code, mimeXml, append([]byte(xml.Header), msg...))
+}
+
+// CSV streams data as CSV. If filename isn't empty, the response is sent as
+// an attachment named filename. The data can be:
+//   - [][]string: rows including the header row (if any)
+//   - a slice of structs (or pointers to structs): the header row is made of
+//     field names (or names specified by `csv` tags), `csv:"-"` skips a field
+//   - a channel of []string, structs or pointers to structs
+func (p *Context) CSV(code int, filename string, data interface{}) {
+	et, err := elemType(data)
+	if err == nil && !isCSVRow(et) {
+		err = fmt.Errorf("unsupported row type %v", et)
+	}
+	if err != nil {
+		log.Panicln("CSV:", err)
+	}
+	w := p.ResponseWriter
+	h := w.Header()
+	h.Set("Content-Type", mimeCsv)
+	if filename != "" {
+		h.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	}
+	w.WriteHeader(code)
+	cw := csv.NewWriter(w)
+	var header []csvField
+	headerDone := false
+	eachElem(p, data, func(row reflect.Value) bool {
+		for row.Kind() == reflect.Ptr || row.Kind() == reflect.Interface {
+			row = row.Elem()
+		}
+		var rec []string
+		if row.Kind() == reflect.Struct {
+			if !headerDone {
+				header, headerDone = csvFields(row.Type()), true
+				names := make([]string, len(header))
+				for i, fld := range header {
+					names[i] = fld.name
+				}
+				cw.Write(names)
+			}
+			rec = make([]string, len(header))
+			for i, fld := range header {
+				rec[i] = csvValue(row.FieldByIndex(fld.index))
+			}
+		} else {
+			rec, _ = row.Interface().([]string)
+		}
+		return cw.Write(rec) == nil
+	})
+	cw.Flush()
+}
+
+// isCSVRow reports whether elements of type t can be written as CSV rows.
+func isCSVRow(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct, reflect.Interface:
+		return true
+	}
+	return t == tyStrings
+}
+
+var tyStrings = reflect.TypeOf([]string(nil))
+
+type csvField struct {
+	name  string
+	index []int
+}
+
+func csvFields(t reflect.Type) []csvField {
+	flds := make([]csvField, 0, t.NumField())
+	for i, n := 0, t.NumField(); i < n; i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		name := sf.Tag.Get("csv")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		flds = append(flds, csvField{name, sf.Index})
+	}
+	return flds
+}
+
+func csvValue(v reflect.Value) string {
+	if v.CanInterface() {
+		switch x := v.Interface().(type) {
+		case string:
+			return x
+		case encoding.TextMarshaler:
+			if b, err := x.MarshalText(); err == nil {
+				return string(b)
+			}
+		}
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// NDJSON streams data as newline delimited JSON (JSON lines), and flushes
+// each line. The data can be a slice, a channel, or an iterator function
+// like `func(yield func(T) bool)`. Streaming stops when the client is gone.
+func (p *Context) NDJSON(code int, data interface{}) {
+	if _, err := elemType(data); err != nil {
+		log.Panicln("NDJSON:", err)
+	}
+	w := p.ResponseWriter
+	w.Header().Set("Content-Type", mimeNdjson)
+	w.WriteHeader(code)
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	eachElem(p, data, func(v reflect.Value) bool {
+		if enc.Encode(v.Interface()) != nil {
+			return false
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return true
+	})
+}
+
+// elemType returns the element type of data if it's a slice, an array, a
+// channel or an iterator function like `func(yield func(T) bool)`.
+func elemType(data interface{}) (reflect.Type, error) {
+	t := reflect.TypeOf(data)
+	if t == nil {
+		return nil, errors.New("unsupported data type <nil>")
+	}
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		return t.Elem(), nil
+	case reflect.Chan:
+		if t.ChanDir()&reflect.RecvDir != 0 {
+			return t.Elem(), nil
+		}
+	case reflect.Func:
+		if t.NumIn() == 1 && t.NumOut() == 0 {
+			yt := t.In(0)
+			if yt.Kind() == reflect.Func && yt.NumIn() == 1 && yt.NumOut() == 1 && yt.Out(0).Kind() == reflect.Bool {
+				return yt.In(0), nil
+			}
+		}
+		return nil, fmt.Errorf("unsupported iterator type %v", t)
+	}
+	return nil, fmt.Errorf("unsupported data type %v", t)
+}
+
+// eachElem iterates elements of a slice, a channel or an iterator function
+// until f returns false or the request is done. data must be checked by
+// elemType first.
+func eachElem(ctx *Context, data interface{}, f func(v reflect.Value) bool) {
+	v := reflect.ValueOf(data)
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i, n := 0, v.Len(); i < n; i++ {
+			if !f(v.Index(i)) {
+				break
+			}
+		}
+	case reflect.Chan:
+		done := reflect.ValueOf(ctx.Context().Done())
+		cases := []reflect.SelectCase{
+			{Dir: reflect.SelectRecv, Chan: v},
+			{Dir: reflect.SelectRecv, Chan: done},
+		}
+		for {
+			chosen, elem, ok := reflect.Select(cases)
+			if chosen != 0 || !ok || !f(elem) {
+				break
+			}
+		}
+	case reflect.Func: // func(yield func(T) bool)
+		yt := v.Type().In(0)
+		done := ctx.Context().Done()
+		yield := reflect.MakeFunc(yt, func(args []reflect.Value) []reflect.Value {
+			ok := f(args[0])
+			if ok {
+				select {
+				case <-done:
+					ok = false
+				default:
+				}
+			}
+			return []reflect.Value{reflect.ValueOf(ok)}
+		})
+		v.Call([]reflect.Value{yield})
+	}
+}
+
+// Render renders data in the format chosen by content negotiation (the Accept
+// header): JSON (default), XML, CSV, NDJSON or plain text. Only formats which
+// can represent data are offered: CSV and NDJSON for slices, arrays, channels
+// and iterator functions, and XML for data without maps. Channels and iterator
+// functions are rendered as NDJSON by default.
+func (p *Context) Render(code int, data interface{}) {
+	switch negotiate(p.Request.Header.Get("Accept"), renderOffers(data)...) {
+	case mimeXml, "text/xml":
+		p.XML(code, data)
+	case mimeCsv:
+		p.CSV(code, "", data)
+	case mimeNdjson:
+		p.NDJSON(code, data)
+	case mimeText:
+		p.TEXT(code, mimeText, fmt.Sprint(data))
+	default:
+		p.JSON(code, data)
+	}
+}
+
+// renderOffers returns formats which can represent data, the default first.
+func renderOffers(data interface{}) []string {
+	var stream, rows bool
+	if et, err := elemType(data); err == nil {
+		stream, rows = true, isCSVRow(et)
+	}
+	t := reflect.TypeOf(data)
+	value := t == nil || (t.Kind() != reflect.Chan && t.Kind() != reflect.Func)
+	xml := canXML(t)
+	offers := make([]string, 0, 6)
+	for _, offer := range [...]struct {
+		mime string
+		ok   bool
+	}{
+		{mimeJson, value}, {mimeXml, xml}, {mimeNdjson, stream},
+		{mimeText, value}, {mimeCsv, rows}, {"text/xml", xml},
+	} {
+		if offer.ok {
+			offers = append(offers, offer.mime)
+		}
+	}
+	return offers
+}
+
+// canXML reports whether values of type t can be marshaled by encoding/xml.
+// Maps, channels and functions can't.
+func canXML(t reflect.Type) bool {
+	if t == nil {
+		return true
+	}
+	for {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Array:
+			t = t.Elem()
+		case reflect.Map, reflect.Chan, reflect.Func, reflect.Complex64, reflect.Complex128, reflect.UnsafePointer:
+			return false
+		default:
+			return true
+		}
+	}
+}
+
+// negotiate returns the offer with the highest quality value in the Accept
+// header. The first offer is preferred on ties and when nothing matches.
+func negotiate(accept string, offers ...string) string {
+	if accept == "" {
+		return offers[0]
+	}
+	best, bestQ, bestSpecific := offers[0], -1.0, -1
+	for _, item := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(item))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if s, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(s, 64); err != nil {
+				continue
+			}
+		}
+		for _, offer := range offers {
+			specific := mimeMatch(mt, offer)
+			if specific < 0 {
+				continue
+			}
+			if q > bestQ || (q == bestQ && specific > bestSpecific) {
+				best, bestQ, bestSpecific = offer, q, specific
+			}
+			break
+		}
+	}
+	if bestQ <= 0 {
+		return offers[0]
+	}
+	return best
+}
+
+// mimeMatch reports how specific pattern (eg. text/*) matches mime: -1 means
+// not matched, 0 for */*, 1 for type/*, 2 for an exact match.
+func mimeMatch(pattern, mime string) int {
+	if pattern == mime {
+		return 2
+	}
+	if pattern == "*/*" {
+		return 0
+	}
+	if strings.HasSuffix(pattern, "/*") && strings.HasPrefix(mime, pattern[:len(pattern)-1]) {
+		return 1
+	}
+	return -1
+}
@@ -0,0 +1,148 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package yap
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type renderUser struct {
+	Name  string `json:"name" csv:"name"`
+	Age   int    `json:"age" csv:"age"`
+	Email string `json:"-" csv:"-"`
+}
+
+func serveData(e *Engine, path, accept string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", path, nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, req)
+	return w
+}
+
+func TestXMLCSVNDJSON(t *testing.T) {
+	users := []renderUser{{"Ann", 30, "ann@x"}, {"Bob", 25, "bob@x"}}
+	e := New()
+	e.GET("/xml", func(ctx *Context) {
+		ctx.XML(200, users[0])
+	})
+	e.GET("/csv", func(ctx *Context) {
+		ctx.CSV(200, "users.csv", users)
+	})
+	e.GET("/csv/rows", func(ctx *Context) {
+		ch := make(chan []string, 2)
+		ch <- []string{"a", "b"}
+		ch <- []string{"1", "2"}
+		close(ch)
+		ctx.CSV(200, "", ch)
+	})
+	e.GET("/ndjson", func(ctx *Context) {
+		ctx.NDJSON(200, func(yield func(renderUser) bool) {
+			for _, u := range users {
+				if !yield(u) {
+					return
+				}
+			}
+		})
+	})
+	e.GET("/csv/bad", func(ctx *Context) {
+		ctx.CSV(200, "", []int{1, 2})
+	})
+	e.GET("/ndjson/bad", func(ctx *Context) {
+		ctx.NDJSON(200, H{"a": 1})
+	})
+
+	w := serveData(e, "/xml", "")
+	if w.Code != 200 || w.Header().Get("Content-Type") != mimeXml ||
+		w.Body.String() != `<?xml version="1.0" encoding="UTF-8"?>`+"\n"+`<renderUser><Name>Ann</Name><Age>30</Age><Email>ann@x</Email></renderUser>` {
+		t.Fatal("XML:", w.Code, w.Header(), w.Body.String())
+	}
+	w = serveData(e, "/csv", "")
+	if w.Code != 200 || w.Header().Get("Content-Disposition") != `attachment; filename=users.csv` ||
+		w.Body.String() != "name,age\nAnn,30\nBob,25\n" {
+		t.Fatal("CSV:", w.Code, w.Header(), w.Body.String())
+	}
+	if w = serveData(e, "/csv/rows", ""); w.Body.String() != "a,b\n1,2\n" {
+		t.Fatal("CSV rows:", w.Body.String())
+	}
+	w = serveData(e, "/ndjson", "")
+	if w.Header().Get("Content-Type") != mimeNdjson || w.Body.String() != `{"name":"Ann","age":30}`+"\n"+`{"name":"Bob","age":25}`+"\n" {
+		t.Fatal("NDJSON:", w.Header(), w.Body.String())
+	}
+	e.PanicHandler = func(w http.ResponseWriter, r *http.Request, v interface{}) {
+		w.WriteHeader(500)
+	}
+	for _, path := range []string{"/csv/bad", "/ndjson/bad"} {
+		if w = serveData(e, path, ""); w.Code != 500 || w.Header().Get("Content-Type") != "" {
+			t.Fatal("unsupported data:", path, w.Code, w.Header())
+		}
+	}
+}
+
+func TestRenderNegotiation(t *testing.T) {
+	users := []renderUser{{"Ann", 30, ""}}
+	e := New()
+	e.GET("/users", func(ctx *Context) {
+		ctx.Render(200, users)
+	})
+	e.GET("/map", func(ctx *Context) {
+		ctx.Render(200, H{"name": "Ann"})
+	})
+	e.GET("/stream", func(ctx *Context) {
+		ch := make(chan renderUser, 1)
+		ch <- users[0]
+		close(ch)
+		ctx.Render(200, ch)
+	})
+	e.GET("/ints", func(ctx *Context) {
+		ctx.Render(200, []int{1, 2})
+	})
+
+	cases := []struct {
+		path, accept, mime, body string
+	}{
+		{"/users", "", mimeJson, `[{"name":"Ann","age":30}]`},
+		{"/users", "*/*", mimeJson, `[{"name":"Ann","age":30}]`},
+		{"/users", "text/csv", mimeCsv, "name,age\nAnn,30\n"},
+		{"/users", "application/x-ndjson", mimeNdjson, `{"name":"Ann","age":30}` + "\n"},
+		{"/users", "text/html;q=0.9, application/xml", mimeXml, "<renderUser>"},
+		{"/users", "text/xml", mimeXml, "<renderUser>"},
+		{"/users", "application/json;q=0.5, text/csv", mimeCsv, "name,age"},
+		{"/users", "text/*", mimeText, "[{Ann 30 }]"},
+		{"/users", "image/png", mimeJson, `[{"name":"Ann","age":30}]`},
+		{"/map", "text/csv", mimeJson, `{"name":"Ann"}`},
+		{"/map", "application/x-ndjson", mimeJson, `{"name":"Ann"}`},
+		{"/map", "application/xml", mimeJson, `{"name":"Ann"}`},
+		{"/map", "text/xml, text/plain;q=0.5", mimeText, "map[name:Ann]"},
+		{"/stream", "", mimeNdjson, `{"name":"Ann","age":30}` + "\n"},
+		{"/stream", "application/json", mimeNdjson, `{"name":"Ann","age":30}` + "\n"},
+		{"/ints", "text/csv", mimeJson, "[1,2]"},
+		{"/ints", "application/x-ndjson", mimeNdjson, "1\n2\n"},
+	}
+	for _, c := range cases {
+		w := serveData(e, c.path, c.accept)
+		ctype := w.Header().Get("Content-Type")
+		if w.Code != 200 || !strings.HasPrefix(ctype, c.mime) || !strings.Contains(w.Body.String(), c.body) {
+			t.Fatal("Render:", c.path, c.accept, "=>", w.Code, ctype, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,288 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package yap
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RouteOption represents an option of a route. See router.Route.
+type RouteOption func(opts *routeOptions)
+
+type routeOptions struct {
+	timeout     time.Duration
+	timeoutCode int
+	bodyTimeout time.Duration
+	maxBodySize Size
+	etag        int
+	cacheTTL    time.Duration
+	cacheSWR    time.Duration
+	cacheTags   []string
+	layout      string
+	hasLayout   bool
+}
+
+// Timeout sets the timeout of a route handler. When it expires, the request
+// context (ctx.Request.Context()) is cancelled, and the request is answered
+// with code (default is 503) if the handler hasn't written the response yet.
+// Database queries aren't cancelled by the timeout unless they use the request
+// context, eg. ydb queries must be issued by `cls.WithContext(ctx.Context())`
+// since ydb classes are shared by all requests.
+func Timeout(d time.Duration, code ...int) RouteOption {
+	statusCode := http.StatusServiceUnavailable
+	if code != nil {
+		statusCode = code[0]
+	}
+	return func(opts *routeOptions) {
+		opts.timeout, opts.timeoutCode = d, statusCode
+	}
+}
+
+// BodyTimeout sets the timeout of reading the request body.
+func BodyTimeout(d time.Duration) RouteOption {
+	return func(opts *routeOptions) {
+		opts.bodyTimeout = d
+	}
+}
+
+// MaxBodySize limits the size of the request body. Requests with a larger
+// Content-Length are answered with 413 without calling the handler, and
+// reading more than n bytes of the body fails.
+func MaxBodySize(n Size) RouteOption {
+	return func(opts *routeOptions) {
+		opts.maxBodySize = n
+	}
+}
+
+func applyRouteOptions(path string, handle func(ctx *Context), opts []RouteOption) func(ctx *Context) {
+	if opts == nil {
+		return handle
+	}
+	var o routeOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.hasLayout {
+		handle = layoutHandle(handle, o.layout)
+	}
+	if o.etag != etagNone {
+		handle = etagHandle(handle, o.etag)
+	}
+	if o.timeout > 0 {
+		handle = timeoutHandle(handle, o.timeout, o.timeoutCode)
+	}
+	if o.bodyTimeout > 0 || o.maxBodySize > 0 {
+		handle = limitBody(handle, o.bodyTimeout, int64(o.maxBodySize))
+	}
+	if o.cacheTTL > 0 {
+		handle = cacheHandle(handle, path, &o)
+	}
+	return handle
+}
+
+// -----------------------------------------------------------------------------
+
+func etagHandle(handle func(ctx *Context), mode int) func(ctx *Context) {
+	return func(ctx *Context) {
+		ctx.etag = mode
+		handle(ctx)
+	}
+}
+
+func limitBody(handle func(ctx *Context), timeout time.Duration, maxSize int64) func(ctx *Context) {
+	return func(ctx *Context) {
+		if maxSize > 0 {
+			if ctx.ContentLength > maxSize {
+				code := http.StatusRequestEntityTooLarge
+				http.Error(ctx.ResponseWriter, http.StatusText(code), code)
+				return
+			}
+			ctx.Body = http.MaxBytesReader(ctx.ResponseWriter, ctx.Body, maxSize)
+		}
+		if timeout > 0 {
+			deadline := time.Now().Add(timeout)
+			if !setReadDeadline(ctx.ResponseWriter, deadline) {
+				ctx.Body = &deadlineReader{ctx.Body, deadline}
+			}
+		}
+		handle(ctx)
+	}
+}
+
+type readDeadliner interface {
+	SetReadDeadline(deadline time.Time) error
+}
+
+// setReadDeadline sets the read deadline of the connection if the
+// ResponseWriter supports it (Go 1.20+).
+func setReadDeadline(w http.ResponseWriter, deadline time.Time) bool {
+	for {
+		switch rw := w.(type) {
+		case readDeadliner:
+			return rw.SetReadDeadline(deadline) == nil
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = rw.Unwrap()
+		default:
+			return false
+		}
+	}
+}
+
+var errBodyTimeout = errors.New("yap: read request body timeout")
+
+// deadlineReader fails reading after the deadline. It can't interrupt a
+// blocking read, but it bounds the total time of reading the body.
+type deadlineReader struct {
+	io.ReadCloser
+	deadline time.Time
+}
+
+func (p *deadlineReader) Read(b []byte) (int, error) {
+	if time.Now().After(p.deadline) {
+		return 0, errBodyTimeout
+	}
+	return p.ReadCloser.Read(b)
+}
+
+// -----------------------------------------------------------------------------
+
+func timeoutHandle(handle func(ctx *Context), timeout time.Duration, code int) func(ctx *Context) {
+	return func(ctx *Context) {
+		c, cancel := context.WithTimeout(ctx.Request.Context(), timeout)
+		defer cancel()
+
+		w := ctx.ResponseWriter
+		tw := &timeoutWriter{w: w, h: w.Header().Clone(), ctx: c}
+		ctx.ResponseWriter = tw
+		ctx.Request = ctx.Request.WithContext(c)
+
+		done := make(chan struct{})
+		panicChan := make(chan any, 1)
+		go func() {
+			defer func() {
+				if e := recover(); e != nil {
+					panicChan <- e
+				}
+			}()
+			handle(ctx)
+			close(done)
+		}()
+		select {
+		case e := <-panicChan:
+			panic(e)
+		case <-done:
+			return
+		case <-c.Done():
+		}
+		if c.Err() == context.DeadlineExceeded {
+			tw.mutex.Lock()
+			if tw.expired() {
+				tw.mutex.Unlock()
+				http.Error(w, http.StatusText(code), code)
+				return
+			}
+			tw.mutex.Unlock()
+		}
+		// the response is started or the client is gone, wait for the handler
+		select {
+		case e := <-panicChan:
+			panic(e)
+		case <-done:
+		}
+	}
+}
+
+// timeoutWriter is a ResponseWriter which discards writes after the timeout
+// expires if the response isn't started.
+type timeoutWriter struct {
+	w           http.ResponseWriter
+	h           http.Header
+	ctx         context.Context
+	mutex       sync.Mutex
+	wroteHeader bool
+	timedOut    bool
+}
+
+// expired reports whether the timeout expires before the response is started.
+// The handler may see ctx done before timeoutHandle does, so writes check it
+// too. It must be called with mutex held.
+func (p *timeoutWriter) expired() bool {
+	if !p.timedOut && !p.wroteHeader && p.ctx.Err() == context.DeadlineExceeded {
+		p.timedOut = true
+	}
+	return p.timedOut
+}
+
+func (p *timeoutWriter) Header() http.Header {
+	return p.h
+}
+
+func (p *timeoutWriter) WriteHeader(code int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if !p.expired() {
+		p.writeHeader(code)
+	}
+}
+
+func (p *timeoutWriter) writeHeader(code int) {
+	if p.wroteHeader {
+		return
+	}
+	p.wroteHeader = true
+	dst := p.w.Header()
+	for k := range dst {
+		delete(dst, k)
+	}
+	for k, v := range p.h {
+		dst[k] = v
+	}
+	p.w.WriteHeader(code)
+}
+
+func (p *timeoutWriter) Write(b []byte) (int, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.expired() {
+		return 0, http.ErrHandlerTimeout
+	}
+	p.writeHeader(http.StatusOK)
+	return p.w.Write(b)
+}
+
+// Flush implements http.Flusher.
+func (p *timeoutWriter) Flush() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.expired() {
+		return
+	}
+	p.writeHeader(http.StatusOK)
+	if f, ok := p.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying ResponseWriter.
+func (p *timeoutWriter) Unwrap() http.ResponseWriter {
+	return p.w
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package yap
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimeout(t *testing.T) {
+	late := make(chan error, 1)
+	e := New()
+	e.GET("/slow", func(ctx *Context) {
+		ctx.ResponseWriter.Header().Set("X-Handler", "slow")
+		<-ctx.Context().Done()
+		_, err := ctx.ResponseWriter.Write([]byte("late"))
+		late <- err
+	}, Timeout(20*time.Millisecond))
+	e.GET("/gateway", func(ctx *Context) {
+		<-ctx.Context().Done()
+	}, Timeout(20*time.Millisecond, http.StatusGatewayTimeout))
+	e.GET("/started", func(ctx *Context) {
+		ctx.ResponseWriter.Write([]byte("partial"))
+		time.Sleep(50 * time.Millisecond)
+		ctx.ResponseWriter.Write([]byte(" done"))
+	}, Timeout(20*time.Millisecond))
+	e.GET("/fast", func(ctx *Context) {
+		ctx.TEXT(201, "text/plain", "fast")
+	}, Timeout(time.Second))
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+	w := serve("/slow")
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "Service Unavailable") {
+		t.Fatal("timeout:", w.Code, w.Body.String())
+	}
+	if err := <-late; err != http.ErrHandlerTimeout {
+		t.Fatal("write after timeout:", err)
+	}
+	if strings.Contains(w.Body.String(), "late") || w.Header().Get("X-Handler") != "" {
+		t.Fatal("write after timeout is not dropped:", w.Body.String(), w.Header())
+	}
+	if w = serve("/gateway"); w.Code != http.StatusGatewayTimeout {
+		t.Fatal("timeout code:", w.Code)
+	}
+	if w = serve("/started"); w.Code != 200 || w.Body.String() != "partial done" {
+		t.Fatal("timeout after the response is started:", w.Code, w.Body.String())
+	}
+	if w = serve("/fast"); w.Code != 201 || w.Body.String() != "fast" {
+		t.Fatal("no timeout:", w.Code, w.Body.String())
+	}
+}
+
+type slowReader struct {
+	r     io.Reader
+	delay time.Duration
+}
+
+func (p *slowReader) Read(b []byte) (int, error) {
+	time.Sleep(p.delay)
+	if len(b) > 1 {
+		b = b[:1]
+	}
+	return p.r.Read(b)
+}
+
+func TestLimitBody(t *testing.T) {
+	called := false
+	var readErr error
+	e := New()
+	e.POST("/upload", func(ctx *Context) {
+		called = true
+		_, readErr = io.ReadAll(ctx.Body)
+	}, MaxBodySize(8), BodyTimeout(30*time.Millisecond))
+
+	post := func(body io.Reader, size int64) int {
+		called, readErr = false, nil
+		req := httptest.NewRequest("POST", "/upload", body)
+		req.ContentLength = size
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := post(strings.NewReader("0123456789"), 10); code != http.StatusRequestEntityTooLarge || called {
+		t.Fatal("Content-Length too large:", code, called)
+	}
+	if post(strings.NewReader("0123456789"), -1); !called || readErr == nil {
+		t.Fatal("body too large:", called, readErr)
+	}
+	if code := post(strings.NewReader("01234567"), 8); code != 200 || readErr != nil {
+		t.Fatal("body:", code, readErr)
+	}
+	if post(&slowReader{strings.NewReader("0123456"), 10 * time.Millisecond}, 7); readErr != errBodyTimeout {
+		t.Fatal("body timeout:", readErr)
+	}
+}
@@ -26,6 +26,7 @@ import (
 	"strings"
 
 	"github.com/goplus/yap/internal/url"
+	"github.com/goplus/yap/trace"
 )
 
 // router is a http rounter which can be used to dispatch requests to different
@@ -94,39 +95,39 @@ func (r *router) init() {
 	r.HandleOPTIONS = true
 }
 
-// GET is a shortcut for router.Route(http.MethodGet, path, handle)
-func (r *router) GET(path string, handle func(ctx *Context)) {
-	r.Route(http.MethodGet, path, handle)
+// GET is a shortcut for router.Route(http.MethodGet, path, handle, opts...)
+func (r *router) GET(path string, handle func(ctx *Context), opts ...RouteOption) {
+	r.Route(http.MethodGet, path, handle, opts...)
 }
 
-// HEAD is a shortcut for router.Route(http.MethodHead, path, handle)
-func (r *router) HEAD(path string, handle func(ctx *Context)) {
-	r.Route(http.MethodHead, path, handle)
+// HEAD is a shortcut for router.Route(http.MethodHead, path, handle, opts...)
+func (r *router) HEAD(path string, handle func(ctx *Context), opts ...RouteOption) {
+	r.Route(http.MethodHead, path, handle, opts...)
 }
 
-// OPTIONS is a shortcut for router.Route(http.MethodOptions, path, handle)
-func (r *router) OPTIONS(path string, handle func(ctx *Context)) {
-	r.Route(http.MethodOptions, path, handle)
+// OPTIONS is a shortcut for router.Route(http.MethodOptions, path, handle, opts...)
+func (r *router) OPTIONS(path string, handle func(ctx *Context), opts ...RouteOption) {
+	r.Route(http.MethodOptions, path, handle, opts...)
 }
 
-// POST is a shortcut for router.Route(http.MethodPost, path, handle)
-func (r *router) POST(path string, handle func(ctx *Context)) {
-	r.Route(http.MethodPost, path, handle)
+// POST is a shortcut for router.Route(http.MethodPost, path, handle, opts...)
+func (r *router) POST(path string, handle func(ctx *Context), opts ...RouteOption) {
+	r.Route(http.MethodPost, path, handle, opts...)
 }
 
-// PUT is a shortcut for router.Route(http.MethodPut, path, handle)
-func (r *router) PUT(path string, handle func(ctx *Context)) {
-	r.Route(http.MethodPut, path, handle)
+// PUT is a shortcut for router.Route(http.MethodPut, path, handle, opts...)
+func (r *router) PUT(path string, handle func(ctx *Context), opts ...RouteOption) {
+	r.Route(http.MethodPut, path, handle, opts...)
 }
 
-// PATCH is a shortcut for router.Route(http.MethodPatch, path, handle)
-func (r *router) PATCH(path string, handle func(ctx *Context)) {
-	r.Route(http.MethodPatch, path, handle)
+// PATCH is a shortcut for router.Route(http.MethodPatch, path, handle, opts...)
+func (r *router) PATCH(path string, handle func(ctx *Context), opts ...RouteOption) {
+	r.Route(http.MethodPatch, path, handle, opts...)
 }
 
-// DELETE is a shortcut for router.Route(http.MethodDelete, path, handle)
-func (r *router) DELETE(path string, handle func(ctx *Context)) {
-	r.Route(http.MethodDelete, path, handle)
+// DELETE is a shortcut for router.Route(http.MethodDelete, path, handle, opts...)
+func (r *router) DELETE(path string, handle func(ctx *Context), opts ...RouteOption) {
+	r.Route(http.MethodDelete, path, handle, opts...)
 }
 
 // Route registers a new request handle with the given path and method.
@@ -137,7 +138,10 @@ func (r *router) DELETE(path string, handle func(ctx *Context)) {
 // This function is intended for bulk loading and to allow the usage of less
 // frequently used, non-standardized or custom methods (e.g. for internal
 // communication with a proxy).
-func (r *router) Route(method, path string, handle func(ctx *Context)) {
+//
+// Options like Timeout, BodyTimeout, MaxBodySize, AutoETag, Cache and Layout
+// can be specified per route.
+func (r *router) Route(method, path string, handle func(ctx *Context), opts ...RouteOption) {
 	if method == "" {
 		panic("method must not be empty")
 	}
@@ -162,7 +166,7 @@ func (r *router) Route(method, path string, handle func(ctx *Context)) {
 		r.globalAllowed = r.allowed("*", "")
 	}
 
-	root.addRoute(path, handle)
+	root.addRoute(path, tracedHandle(method, path, applyRouteOptions(path, handle, opts)))
 }
 
 // DefaultWriter is the default io.Writer used by Yap to debug information
@@ -245,6 +249,11 @@ func (r *router) serveHTTP(w http.ResponseWriter, req *http.Request, e *Engine)
 		defer r.recv(w, req)
 	}
 
+	if req.Header.Get(trace.HeaderTraceparent) != "" {
+		req = req.WithContext(trace.Extract(req.Context(), req.Header))
+	}
+
+	req = e.stripLocale(req)
 	path := req.URL.Path
 	root := r.trees[req.Method]
 	if root != nil {
@@ -310,5 +319,8 @@ func (r *router) serveHTTP(w http.ResponseWriter, req *http.Request, e *Engine)
 		}
 	}
 
+	if e.serveHealth(w, req) {
+		return
+	}
 	e.Mux.ServeHTTP(w, req)
 }
@@ -0,0 +1,248 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package yap
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// DefaultShutdownTimeout is the default time to wait for in-flight requests
+// to complete when shutting down.
+const DefaultShutdownTimeout = 20 * time.Second
+
+type graceful struct {
+	mutex    sync.Mutex
+	closing  chan struct{} // closed when shutting down starts
+	hooks    []func()
+	timeout  time.Duration
+	drain    time.Duration
+	inflight int32
+}
+
+func (p *graceful) closingChan() chan struct{} {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.closing == nil {
+		p.closing = make(chan struct{})
+	}
+	return p.closing
+}
+
+// SetShutdownTimeout sets the time to wait for in-flight requests (including
+// long SSE/WebSocket connections) to complete when shutting down. Default is
+// DefaultShutdownTimeout.
+func (p *Engine) SetShutdownTimeout(d time.Duration) {
+	p.graceful.timeout = d
+}
+
+// SetShutdownDrain sets the time to keep serving new requests after shutting
+// down starts, before the listeners are closed. During it /readyz fails (see
+// SetHealthPaths), so load balancers can stop routing requests to the engine
+// in time. Default is 0.
+func (p *Engine) SetShutdownDrain(d time.Duration) {
+	p.graceful.drain = d
+}
+
+// OnShutdown registers a function to call when the engine shuts down, after
+// in-flight requests are drained. Hooks are called in the reverse order of
+// registration, eg. to close database connections.
+func (p *Engine) OnShutdown(f func()) {
+	p.graceful.mutex.Lock()
+	p.graceful.hooks = append(p.graceful.hooks, f)
+	p.graceful.mutex.Unlock()
+}
+
+// ShuttingDown returns a channel that's closed when the engine starts shutting
+// down. Long running handlers (eg. SSE, WebSocket) should select on it and
+// return in time.
+func (p *Engine) ShuttingDown() <-chan struct{} {
+	return p.graceful.closingChan()
+}
+
+// ShuttingDown returns a channel that's closed when the engine starts shutting
+// down. See Engine.ShuttingDown.
+func (p *Context) ShuttingDown() <-chan struct{} {
+	return p.engine.ShuttingDown()
+}
+
+// RunContext listens on the network address addr and then serves requests on
+// incoming connections until ctx is done. Then it stops accepting new
+// connections, waits in-flight requests to complete (see SetShutdownTimeout),
+// and calls hooks registered by OnShutdown.
+//
+// If listenAndServe func is customized by SetLAS, RunContext just calls it and
+// ctx is ignored.
+func (p *Engine) RunContext(ctx context.Context, addr string, mws ...func(h http.Handler) http.Handler) error {
+	h := p.Handler(mws...)
+
+	debugPrint("Listening and serving HTTP on %s\n", addr)
+
+	if p.las != nil {
+		return p.las(addr, h)
+	}
+	ln, err := listen(addr)
+	if err != nil {
+		return err
+	}
+	h, svrs, err := p.listenExtra(h)
+	if err != nil {
+		ln.Close()
+		return err
+	}
+	return p.serve(ctx, append(svrs, p.plainServer(ln, h))...)
+}
+
+// server is a http.Server with its listener.
+type server struct {
+	*http.Server
+	ln  net.Listener
+	tls bool
+}
+
+func (p server) serve() error {
+	if p.tls {
+		return p.ServeTLS(p.ln, "", "")
+	}
+	return p.Serve(p.ln)
+}
+
+// closeListeners closes listeners of svrs which are not serving yet.
+func closeListeners(svrs []server) {
+	for _, svr := range svrs {
+		svr.ln.Close()
+	}
+}
+
+func (p *Engine) plainServer(ln net.Listener, h http.Handler) server {
+	svr := &http.Server{Handler: p.track(h)}
+	if p.h2c {
+		svr.Handler = p.h2cHandler(svr, svr.Handler)
+	}
+	return server{svr, ln, false}
+}
+
+// serve serves requests by svrs until ctx is done or any of them fails.
+func (p *Engine) serve(ctx context.Context, svrs ...server) error {
+	base, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errc := make(chan error, len(svrs))
+	for _, svr := range svrs {
+		svr.BaseContext = func(net.Listener) context.Context { return base }
+		go func(svr server) {
+			errc <- svr.serve()
+		}(svr)
+	}
+	var err error
+	select {
+	case err = <-errc:
+	case <-ctx.Done():
+	}
+	if e := p.shutdown(cancel, svrs); err == nil {
+		err = e
+	}
+	return err
+}
+
+// shutdown notifies handlers by closing ShuttingDown channel, waits the drain
+// delay (see SetShutdownDrain), and waits in-flight requests to complete.
+// When the timeout expires, contexts of the remaining requests are cancelled
+// and their connections are closed.
+func (p *Engine) shutdown(cancel context.CancelFunc, svrs []server) (err error) {
+	g := &p.graceful
+	closing := g.closingChan()
+	g.mutex.Lock()
+	select {
+	case <-closing:
+	default:
+		close(closing)
+	}
+	g.mutex.Unlock()
+
+	if g.drain > 0 {
+		debugPrint("Shutting down, draining for %v\n", g.drain)
+		time.Sleep(g.drain)
+	}
+	timeout := g.timeout
+	if timeout == 0 {
+		timeout = DefaultShutdownTimeout
+	}
+	ctx, done := context.WithTimeout(context.Background(), timeout)
+	defer done()
+
+	debugPrint("Shutting down, waiting for in-flight requests (timeout %v)\n", timeout)
+	for _, svr := range svrs {
+		if e := svr.Shutdown(ctx); e != nil && err == nil {
+			err = e
+		}
+	}
+	if err == nil {
+		err = g.wait(ctx) // handlers of hijacked connections
+	}
+	if err != nil {
+		cancel()
+		for _, svr := range svrs {
+			svr.Close()
+		}
+	}
+	g.mutex.Lock()
+	hooks := g.hooks
+	g.mutex.Unlock()
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hooks[i]()
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		debugPrint("Shutdown timeout, in-flight requests are aborted\n")
+	}
+	return
+}
+
+func (p *graceful) wait(ctx context.Context) error {
+	const pollInterval = 10 * time.Millisecond
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for atomic.LoadInt32(&p.inflight) > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+func (p *Engine) track(h http.Handler) http.Handler {
+	g := &p.graceful
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&g.inflight, 1)
+		defer atomic.AddInt32(&g.inflight, -1)
+		h.ServeHTTP(w, r)
+	})
+}
+
+// signalContext returns a context which is done on SIGINT or SIGTERM.
+func signalContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
@@ -0,0 +1,195 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package yap
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// unixClient returns a http.Client which dials the unix socket sock.
+func unixClient(sock string) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", sock)
+		},
+	}}
+}
+
+// waitServing waits until the server behind c answers a request.
+func waitServing(t *testing.T, c *http.Client, url string) {
+	for i := 0; i < 200; i++ {
+		if resp, err := c.Get(url); err == nil {
+			resp.Body.Close()
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("server is not serving:", url)
+}
+
+type shutdownLog struct {
+	mutex sync.Mutex
+	items []string
+}
+
+func (p *shutdownLog) add(item string) {
+	p.mutex.Lock()
+	p.items = append(p.items, item)
+	p.mutex.Unlock()
+}
+
+func (p *shutdownLog) String() string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	ret := ""
+	for i, item := range p.items {
+		if i > 0 {
+			ret += ","
+		}
+		ret += item
+	}
+	return ret
+}
+
+func TestRunContext(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "app.sock")
+	var log shutdownLog
+	started := make(chan struct{})
+	e := New()
+	e.GET("/ping", func(ctx *Context) {
+		ctx.TEXT(200, "text/plain", "pong")
+	})
+	e.GET("/slow", func(ctx *Context) {
+		close(started)
+		<-ctx.ShuttingDown()
+		time.Sleep(50 * time.Millisecond) // in-flight while shutting down
+		log.add("request")
+		ctx.TEXT(200, "text/plain", "done")
+	})
+	e.OnShutdown(func() { log.add("hook1") })
+	e.OnShutdown(func() { log.add("hook2") })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errc := make(chan error, 1)
+	go func() { errc <- e.RunContext(ctx, "unix:"+sock) }()
+
+	c := unixClient(sock)
+	waitServing(t, c, "http://yap/ping")
+	type result struct {
+		body string
+		err  error
+	}
+	resc := make(chan result, 1)
+	go func() {
+		resp, err := c.Get("http://yap/slow")
+		if err != nil {
+			resc <- result{"", err}
+			return
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		resc <- result{string(b), err}
+	}()
+	<-started
+	select {
+	case <-e.ShuttingDown():
+		t.Fatal("ShuttingDown is closed before shutdown")
+	default:
+	}
+	cancel()
+
+	select {
+	case <-e.ShuttingDown():
+	case <-time.After(time.Second):
+		t.Fatal("ShuttingDown is not closed")
+	}
+	if res := <-resc; res.err != nil || res.body != "done" {
+		t.Fatal("in-flight request:", res.body, res.err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal("RunContext:", err)
+	}
+	if s := log.String(); s != "request,hook2,hook1" {
+		t.Fatal("shutdown order:", s)
+	}
+	if _, err := c.Get("http://yap/ping"); err == nil {
+		t.Fatal("served after shutdown")
+	}
+}
+
+func TestRunContextTimeout(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "app.sock")
+	var log shutdownLog
+	started, aborted := make(chan struct{}), make(chan struct{})
+	e := New()
+	e.SetShutdownTimeout(50 * time.Millisecond)
+	e.GET("/ping", func(ctx *Context) {
+		ctx.TEXT(200, "text/plain", "pong")
+	})
+	e.GET("/stuck", func(ctx *Context) {
+		close(started)
+		<-ctx.Context().Done() // ignores ShuttingDown
+		close(aborted)
+	})
+	e.OnShutdown(func() { log.add("hook") })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errc := make(chan error, 1)
+	go func() { errc <- e.RunContext(ctx, "unix:"+sock) }()
+
+	c := unixClient(sock)
+	waitServing(t, c, "http://yap/ping")
+	go func() {
+		if resp, err := c.Get("http://yap/stuck"); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-started
+	begin := time.Now()
+	cancel()
+
+	select {
+	case err := <-errc:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatal("RunContext:", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("shutdown timeout doesn't expire")
+	}
+	if d := time.Since(begin); d < 50*time.Millisecond {
+		t.Fatal("shutdown returns before timeout:", d)
+	}
+	select {
+	case <-aborted:
+	case <-time.After(time.Second):
+		t.Fatal("context of the in-flight request is not cancelled")
+	}
+	if s := log.String(); s != "hook" {
+		t.Fatal("hooks:", s)
+	}
+}
@@ -0,0 +1,245 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package yap
+
+import (
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// StaticOptions represents options of serving static files by Static or
+// StaticHttp.
+type StaticOptions struct {
+	// Fallback is the file served for unknown paths, eg. "index.html" of a
+	// single-page app whose routes are handled by the client.
+	Fallback string
+
+	// FallbackExcludes are URL path prefixes which don't fall back, eg.
+	// "/api/".
+	FallbackExcludes []string
+
+	// NoListing disables listing directories without an index file.
+	NoListing bool
+
+	// IndexNames are names of index files of directories in order (default
+	// is "index.html").
+	IndexNames []string
+
+	// HideHidden hides files and directories whose names start with ".".
+	HideHidden bool
+
+	// CacheControl maps patterns of file names (see path.Match) to
+	// Cache-Control headers, eg. {"*.html": "no-cache", "*": "max-age=3600"}.
+	// A longer pattern takes priority.
+	CacheControl map[string]string
+}
+
+// SetStaticOptions sets options of serving static files of pattern by Static
+// or StaticHttp. It should be called before requests are served.
+func (p *Engine) SetStaticOptions(pattern string, opts *StaticOptions) {
+	if !strings.HasSuffix(pattern, "/") {
+		pattern += "/"
+	}
+	if p.staticOpts == nil {
+		p.staticOpts = make(map[string]*StaticOptions)
+	}
+	p.staticOpts[pattern] = opts
+}
+
+// -----------------------------------------------------------------------------
+
+type staticHandler struct {
+	engine    *Engine
+	pattern   string
+	fsys      http.FileSystem
+	newServer func(fsys http.FileSystem) http.Handler
+
+	once   sync.Once
+	opts   *StaticOptions
+	server http.Handler
+}
+
+func (p *Engine) staticHandler(pattern string, fsys http.FileSystem, newServer func(http.FileSystem) http.Handler) http.Handler {
+	return &staticHandler{engine: p, pattern: pattern, fsys: fsys, newServer: newServer}
+}
+
+func (h *staticHandler) init() {
+	h.opts = h.engine.staticOpts[h.pattern]
+	if opts := h.opts; opts != nil {
+		if opts.HideHidden {
+			h.fsys = hiddenFS{h.fsys}
+		}
+		if opts.IndexNames != nil {
+			h.fsys = indexFS{h.fsys, opts.IndexNames}
+		}
+	}
+	h.server = http.StripPrefix(h.pattern, h.newServer(h.fsys))
+}
+
+func (h *staticHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.once.Do(h.init)
+	opts := h.opts
+	if opts == nil {
+		h.server.ServeHTTP(w, r)
+		return
+	}
+	name := path.Clean("/" + strings.TrimPrefix(r.URL.Path, h.pattern))
+	f, err := h.fsys.Open(name)
+	if err != nil {
+		if os.IsNotExist(err) && h.fallback(w, r) {
+			return
+		}
+		h.server.ServeHTTP(w, r)
+		return
+	}
+	d, err := f.Stat()
+	f.Close()
+	if err != nil {
+		h.server.ServeHTTP(w, r)
+		return
+	}
+	file := d.Name()
+	if d.IsDir() {
+		index := strings.TrimSuffix(name, "/") + "/index.html"
+		if fi, err := h.stat(index); err == nil {
+			file = fi.Name()
+		} else if h.fallback(w, r) {
+			return
+		} else if opts.NoListing {
+			http.NotFound(w, r)
+			return
+		}
+	}
+	h.setCacheControl(w, file)
+	h.server.ServeHTTP(w, r)
+}
+
+func (h *staticHandler) stat(name string) (fs.FileInfo, error) {
+	f, err := h.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Stat()
+}
+
+// fallback serves the fallback file for an unknown path, and reports whether
+// it's served.
+func (h *staticHandler) fallback(w http.ResponseWriter, r *http.Request) bool {
+	opts := h.opts
+	if opts.Fallback == "" || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		return false
+	}
+	for _, prefix := range opts.FallbackExcludes {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return false
+		}
+	}
+	f, err := h.fsys.Open(path.Clean("/" + opts.Fallback))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	d, err := f.Stat()
+	if err != nil || d.IsDir() {
+		return false
+	}
+	h.setCacheControl(w, d.Name())
+	http.ServeContent(w, r, d.Name(), d.ModTime(), f)
+	return true
+}
+
+func (h *staticHandler) setCacheControl(w http.ResponseWriter, file string) {
+	var pattern, val string
+	found := false
+	for k, v := range h.opts.CacheControl {
+		if ok, _ := path.Match(k, file); ok {
+			if !found || len(k) > len(pattern) || (len(k) == len(pattern) && k < pattern) {
+				pattern, val, found = k, v, true
+			}
+		}
+	}
+	if val != "" {
+		w.Header().Set("Cache-Control", val)
+	}
+}
+
+// -----------------------------------------------------------------------------
+
+// hiddenFS hides files whose names start with ".".
+type hiddenFS struct {
+	http.FileSystem
+}
+
+func (p hiddenFS) Open(name string) (http.File, error) {
+	for _, elem := range strings.Split(name, "/") {
+		if isHidden(elem) {
+			return nil, os.ErrNotExist
+		}
+	}
+	f, err := p.FileSystem.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return hiddenFile{f}, nil
+}
+
+type hiddenFile struct {
+	http.File
+}
+
+func (f hiddenFile) Readdir(count int) ([]fs.FileInfo, error) {
+	for {
+		fis, err := f.File.Readdir(count)
+		ret := fis[:0]
+		for _, fi := range fis {
+			if !isHidden(fi.Name()) {
+				ret = append(ret, fi)
+			}
+		}
+		if len(ret) > 0 || err != nil || count <= 0 {
+			return ret, err
+		}
+	}
+}
+
+func isHidden(name string) bool {
+	return len(name) > 1 && name[0] == '.' && name != ".."
+}
+
+// indexFS opens the first existing file of names for an index file.
+type indexFS struct {
+	http.FileSystem
+	names []string
+}
+
+func (p indexFS) Open(name string) (http.File, error) {
+	if path.Base(name) != "index.html" {
+		return p.FileSystem.Open(name)
+	}
+	dir := path.Dir(name)
+	for _, index := range p.names {
+		if f, err := p.FileSystem.Open(path.Join(dir, index)); err == nil {
+			return f, nil
+		}
+	}
+	return nil, os.ErrNotExist
+}
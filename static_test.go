@@ -0,0 +1,83 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package yap
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestStaticOptions(t *testing.T) {
+	e := New(fstest.MapFS{
+		"static/index.html":      {Data: []byte("<app>")},
+		"static/app.js":          {Data: []byte("js")},
+		"static/.env":            {Data: []byte("secret")},
+		"static/docs/main.html":  {Data: []byte("docs")},
+		"static/files/a.txt":     {Data: []byte("a")},
+		"static/files/.hidden":   {Data: []byte("h")},
+		"public/files/a.txt":     {Data: []byte("a")},
+		"public/files/.b.txt":    {Data: []byte("b")},
+		"public/docs/index.html": {Data: []byte("index")},
+	})
+	e.Static("/")
+	e.SetStaticOptions("/", &StaticOptions{
+		Fallback:         "index.html",
+		FallbackExcludes: []string{"/api/"},
+		NoListing:        true,
+		IndexNames:       []string{"main.html", "index.html"},
+		HideHidden:       true,
+		CacheControl:     map[string]string{"*": "max-age=3600", "*.html": "no-cache"},
+	})
+	e.SetStaticOptions("/pub", &StaticOptions{HideHidden: true})
+	e.Static("/pub", e.FS("public"))
+
+	get := func(url string) (int, string, string) {
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		return w.Code, w.Body.String(), w.Header().Get("Cache-Control")
+	}
+	if code, body, cc := get("/app.js"); code != 200 || body != "js" || cc != "max-age=3600" {
+		t.Fatal("file:", code, body, cc)
+	}
+	if code, body, cc := get("/users/123"); code != 200 || body != "<app>" || cc != "no-cache" {
+		t.Fatal("fallback:", code, body, cc)
+	}
+	if code, _, _ := get("/api/users"); code != 404 {
+		t.Fatal("fallback excludes:", code)
+	}
+	if code, body, _ := get("/.env"); code != 200 || body != "<app>" {
+		t.Fatal("hidden:", code, body)
+	}
+	if code, body, cc := get("/docs/"); code != 200 || body != "docs" || cc != "no-cache" {
+		t.Fatal("index names:", code, body, cc)
+	}
+	if code, body, _ := get("/files/"); code != 200 || body != "<app>" {
+		t.Fatal("no listing:", code, body)
+	}
+
+	if code, body, _ := get("/pub/files/"); code != 200 || !strings.Contains(body, "a.txt") || strings.Contains(body, ".b.txt") {
+		t.Fatal("listing:", code, body)
+	}
+	if code, _, _ := get("/pub/files/.b.txt"); code != 404 {
+		t.Fatal("pub hidden:", code)
+	}
+	if code, body, _ := get("/pub/docs/"); code != 200 || body != "index" {
+		t.Fatal("pub index:", code, body)
+	}
+}
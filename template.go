@@ -17,17 +17,56 @@
 package yap
 
 import (
+	"errors"
 	"fmt"
 	"html/template"
+	"io"
 	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
 	"strings"
+	ttemplate "text/template"
 
 	"github.com/goplus/yap/internal/templ"
 )
 
+var (
+	errTemplateNotFound = errors.New("template not found")
+	rePosition          = regexp.MustCompile(`template: ([^:\s]+):(\d+)`)
+)
+
+// TemplateError represents an error of rendering a YAP template.
+type TemplateError struct {
+	Template string // the template to render
+	Name     string // the template where the error occurs
+	Line     int    // the line where the error occurs, 0 if unknown
+	Err      error
+}
+
+func newTemplateError(yapFile string, err error) *TemplateError {
+	ret := &TemplateError{Template: yapFile, Name: yapFile, Err: err}
+	if m := rePosition.FindStringSubmatch(err.Error()); m != nil {
+		ret.Name = m[1]
+		ret.Line, _ = strconv.Atoi(m[2])
+	}
+	return ret
+}
+
+func (p *TemplateError) Error() string {
+	if p.Line > 0 {
+		return fmt.Sprintf("yap: render %s failed at %s:%d: %v", p.Template, p.Name, p.Line, p.Err)
+	}
+	return fmt.Sprintf("yap: render %s failed: %v", p.Template, p.Err)
+}
+
+func (p *TemplateError) Unwrap() error {
+	return p.Err
+}
+
 // template delimiter, default is {{ }}
 type Delims struct {
 	Left  string
@@ -42,14 +81,16 @@ type Template struct {
 	// yap fs directory
 	fs     fs.FS
 	delims Delims
+	lay    *layouts
+	text   *ttemplate.Template // plain text templates, see Engine.RenderText
 }
 
 // NewTemplate allocates a new, undefined template with the given name.
 func NewTemplate(name string) *Template {
-	return &Template{template.New(name), nil, Delims{"{{", "}}"}}
+	return &Template{template.New(name), nil, Delims{"{{", "}}"}, newLayouts(), nil}
 }
 func (t *Template) NewTemplate(name string) *Template {
-	return &Template{Template: t.Template.New(name), fs: t.fs, delims: t.delims}
+	return &Template{Template: t.Template.New(name), fs: t.fs, delims: t.delims, lay: t.lay}
 }
 
 func (t Template) Parse(text string) (ret Template, err error) {
@@ -58,6 +99,19 @@ func (t Template) Parse(text string) (ret Template, err error) {
 	return
 }
 
+var reDelims = regexp.MustCompile(`^\s*<!--\s*yap:delims\s+(\S+)\s+(\S+)\s*-->`)
+
+// fileDelims returns delimiters of a template file specified by a header
+// directive like `<!-- yap:delims [[ ]] -->`, or def if it isn't specified.
+// The directive is removed from text, except its newlines.
+func fileDelims(text string, def Delims) (Delims, string) {
+	m := reDelims.FindStringSubmatch(text)
+	if m == nil {
+		return def, text
+	}
+	return Delims{m[1], m[2]}, strings.Repeat("\n", strings.Count(m[0], "\n")) + text[len(m[0]):]
+}
+
 func ParseFSFile(f fs.FS, file string, delims Delims) (t Template, err error) {
 	b, err := fs.ReadFile(f, file)
 	if err != nil {
@@ -65,8 +119,9 @@ func ParseFSFile(f fs.FS, file string, delims Delims) (t Template, err error) {
 	}
 	name := filepath.Base(file)
 	t = *NewTemplate(name)
+	delims, text := fileDelims(string(b), delims)
 	t.delims = delims
-	return t.Parse(string(b))
+	return t.Parse(text)
 }
 
 func ParseFiles(filenames ...string) (*Template, error) {
@@ -92,16 +147,38 @@ func parseFiles(t *Template, readFile func(string) (string, []byte, error), file
 		if t == nil {
 			t = NewTemplate(name)
 		}
+		if t.lay == nil {
+			t.lay = newLayouts()
+		}
+		delims, s := fileDelims(s, t.delims)
+		meta, s, err := parseFrontMatter(s)
+		if err != nil {
+			return nil, fmt.Errorf("yap/template: %s: %v", filename, err)
+		}
+		layout, s := extendsOf(s, delims)
+		if meta != nil {
+			t.lay.meta[name] = meta
+			if l, ok := meta["layout"].(string); ok && layout == "" {
+				layout = l
+			}
+		}
+		t.lay.add(name, layout, s, delims)
+		if layout != "" { // parsed when it's rendered, see Template.LookupLayout
+			continue
+		}
 		if name == t.Name() {
 			tmpl = t
 		} else {
 			tmpl = t.NewTemplate(name)
 		}
-		_, err = tmpl.Parse(s)
+		_, err = Template{Template: tmpl.Template, delims: delims}.Parse(s)
 		if err != nil {
 			return nil, err
 		}
 	}
+	if err := t.lay.init(t); err != nil {
+		return nil, err
+	}
 	log.Println("yap/template list:")
 	for i, t2 := range t.Templates() {
 		log.Println(i, t2.Name())
@@ -174,3 +251,118 @@ func readFileFS(fsys fs.FS) func(string) (string, []byte, error) {
 		return
 	}
 }
+
+// -----------------------------------------------------------------------------
+
+// Render renders the template name with data to w, outside of a request, eg.
+// for emails and background jobs. It shares templates, funcs, delimiters and
+// the default layout with YAP, and can be called concurrently. Errors are of
+// type *TemplateError. See RenderText for plain text templates.
+func (p *Engine) Render(w io.Writer, name string, data interface{}) error {
+	if err := p.execute(w, name, "", p.layout, data); err != nil {
+		return err
+	}
+	return nil
+}
+
+// RenderBlock renders the named block of the template name with data to w.
+// See Render.
+func (p *Engine) RenderBlock(w io.Writer, name, block string, data interface{}) error {
+	if err := p.execute(w, name, block, p.layout, data); err != nil {
+		return err
+	}
+	return nil
+}
+
+// RenderString renders the template name with data to a string. See Render.
+func (p *Engine) RenderString(name string, data interface{}) (string, error) {
+	var b strings.Builder
+	err := p.Render(&b, name, data)
+	return b.String(), err
+}
+
+func (p *Engine) execute(w io.Writer, name, block, layout string, data interface{}) *TemplateError {
+	tpl, err := p.loadTemplates()
+	if err != nil {
+		return newTemplateError(name, err)
+	}
+	t, err := tpl.LookupLayout(name, layout)
+	if err == nil {
+		if t == nil {
+			err = errTemplateNotFound
+		} else if block != "" {
+			if t = t.Lookup(block); t == nil {
+				err = fmt.Errorf("block %s not found", block)
+			}
+		}
+		if err == nil {
+			if meta := tpl.Meta(name); meta != nil {
+				data = withFields(data, H{"Meta": meta})
+			}
+			err = t.Execute(w, data)
+		}
+	}
+	if err != nil {
+		return newTemplateError(name, err)
+	}
+	return nil
+}
+
+// withFields returns a copy of data with fields added if data is a map (or
+// nil), or with fields set if data is a struct (or a pointer to struct) having
+// exported fields of the names, which are zero. Otherwise data is returned as
+// is.
+func withFields(data interface{}, fields H) interface{} {
+	var m map[string]any
+	switch v := data.(type) {
+	case nil:
+	case H:
+		m = v
+	case map[string]any:
+		m = v
+	default:
+		return withStructFields(data, fields)
+	}
+	ret := make(H, len(m)+len(fields))
+	for k, v := range m {
+		ret[k] = v
+	}
+	for k, v := range fields {
+		ret[k] = v
+	}
+	return ret
+}
+
+func withStructFields(data interface{}, fields H) interface{} {
+	v := reflect.ValueOf(data)
+	isPtr := v.Kind() == reflect.Ptr
+	if isPtr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return data
+	}
+	var ret reflect.Value
+	for name, val := range fields {
+		sf, ok := v.Type().FieldByName(name)
+		if !ok || len(sf.Index) != 1 || !sf.IsExported() || !v.Field(sf.Index[0]).IsZero() {
+			continue
+		}
+		fv := reflect.ValueOf(val)
+		if !fv.IsValid() || !fv.Type().AssignableTo(sf.Type) {
+			continue
+		}
+		if !ret.IsValid() { // copy data before changing it
+			ret = reflect.New(v.Type()).Elem()
+			ret.Set(v)
+		}
+		ret.Field(sf.Index[0]).Set(fv)
+	}
+	if !ret.IsValid() {
+		return data
+	}
+	if isPtr {
+		return ret.Addr().Interface()
+	}
+	return ret.Interface()
+}
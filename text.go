@@ -0,0 +1,135 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package yap
+
+import (
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	ttemplate "text/template"
+
+	"github.com/goplus/yap/internal/templ"
+)
+
+// textSuffix is the suffix of plain text templates, which are parsed by
+// text/template, so their output isn't escaped.
+const textSuffix = "_yap.txt"
+
+// derivePatterns returns patterns of templates with extension ext for
+// patterns of HTML templates, eg. "*_yap.html" => "*_yap.txt".
+func derivePatterns(patterns []string, ext string) []string {
+	ret := make([]string, len(patterns))
+	for i, pattern := range patterns {
+		if strings.HasSuffix(pattern, ".html") {
+			pattern = pattern[:len(pattern)-5] + ext
+		}
+		ret[i] = pattern
+	}
+	return ret
+}
+
+// globFiles returns files matching patterns, which are accepted by accept.
+func globFiles(fsys fs.FS, patterns []string, accept func(file string) bool) ([]string, error) {
+	var files []string
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		list, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range list {
+			if accept(file) && !seen[file] {
+				seen[file] = true
+				files = append(files, file)
+			}
+		}
+	}
+	return files, nil
+}
+
+func (p *Engine) parseTextTemplates(fsys fs.FS, patterns []string, delims Delims) (*ttemplate.Template, error) {
+	files, err := globFiles(fsys, derivePatterns(patterns, ".txt"), isTextFile)
+	if err != nil || files == nil {
+		return nil, err
+	}
+	t := ttemplate.New("").Funcs(ttemplate.FuncMap(builtinFuncs)).
+		Funcs(ttemplate.FuncMap(p.engineFuncs())).Funcs(ttemplate.FuncMap(p.funcs))
+	for _, file := range files {
+		b, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		name := strings.TrimSuffix(filepath.ToSlash(file), textSuffix)
+		d, text := fileDelims(string(b), delims)
+		_, err = t.New(name).Delims(d.Left, d.Right).Parse(templ.Translate(text, d.Left, d.Right))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func isTextFile(file string) bool {
+	return strings.HasSuffix(file, textSuffix)
+}
+
+// -----------------------------------------------------------------------------
+
+// RenderText renders the plain text template name (a `*_yap.txt` file) with
+// data to w. Output of text templates isn't HTML escaped, eg. for plain text
+// emails, CSV exports and config files. See Render.
+func (p *Engine) RenderText(w io.Writer, name string, data interface{}) error {
+	if err := p.executeText(w, name, data); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (p *Engine) executeText(w io.Writer, name string, data interface{}) *TemplateError {
+	tpl, err := p.loadTemplates()
+	if err != nil {
+		return newTemplateError(name+".txt", err)
+	}
+	if t := tpl.text; t == nil {
+		err = errTemplateNotFound
+	} else if t = t.Lookup(name); t == nil {
+		err = errTemplateNotFound
+	} else {
+		err = t.Execute(w, data)
+	}
+	if err != nil {
+		return newTemplateError(name+".txt", err)
+	}
+	return nil
+}
+
+// YAPText renders the plain text template yapFile (a `*_yap.txt` file) with
+// data, and writes the response as text/plain. See YAP.
+func (p *Context) YAPText(code int, yapFile string, data interface{}) {
+	_, span := p.engine.Tracer().Start(p.Request.Context(), "yap.render")
+	defer endSpan(span)
+	span.SetAttr("yap.template", yapFile+".txt")
+	buf := getBuf()
+	defer putBuf(buf)
+	if err := p.engine.executeText(buf, yapFile, p.withLocale(data)); err != nil {
+		span.RecordError(err)
+		p.templateError(err)
+		return
+	}
+	p.DATA(code, "text/plain; charset=utf-8", buf.Bytes())
+}
@@ -0,0 +1,263 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package yap
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// TLSOptions represents options of serving HTTPS.
+type TLSOptions struct {
+	// MinVersion is the minimum TLS version (default is tls.VersionTLS12).
+	MinVersion uint16
+
+	// CipherSuites is the list of enabled TLS 1.0–1.2 cipher suites. If it
+	// is nil, a safe default list is used by crypto/tls.
+	CipherSuites []uint16
+
+	// ClientCAFile is a PEM file of CAs used to verify client certificates.
+	// Setting it enables mutual TLS.
+	ClientCAFile string
+
+	// ClientAuth is the policy for client certificates. Default is
+	// tls.RequireAndVerifyClientCert if ClientCAFile is set. Setting it
+	// without ClientCAFile is an error.
+	ClientAuth tls.ClientAuthType
+
+	// RedirectAddr is the TCP network address (eg. ":80") to listen on and
+	// redirect HTTP requests to HTTPS. Empty means no redirect listener.
+	RedirectAddr string
+}
+
+// SetTLSOptions sets options used by RunTLS.
+func (p *Engine) SetTLSOptions(opts *TLSOptions) {
+	p.tlsOpts = opts
+}
+
+// SetH2C enables or disables serving cleartext HTTP/2 (h2c) by Run, eg. for
+// internal traffic behind a load balancer.
+func (p *Engine) SetH2C(enable bool) {
+	p.h2c = enable
+}
+
+// RunTLS listens on the network address addr (see Run) and then serves HTTPS
+// requests on incoming connections. The certificate and its private key are
+// reloaded automatically when certFile or keyFile changes.
+//
+// RunTLS shuts down gracefully on SIGINT or SIGTERM. See RunTLSContext.
+func (p *Engine) RunTLS(addr, certFile, keyFile string, mws ...func(h http.Handler) http.Handler) error {
+	ctx, stop := signalContext()
+	defer stop()
+	return p.RunTLSContext(ctx, addr, certFile, keyFile, mws...)
+}
+
+// RunTLSContext is like RunTLS but shuts down when ctx is done. See
+// RunContext.
+func (p *Engine) RunTLSContext(ctx context.Context, addr, certFile, keyFile string, mws ...func(h http.Handler) http.Handler) error {
+	h := p.Handler(mws...)
+
+	debugPrint("Listening and serving HTTPS on %s\n", addr)
+
+	if p.las != nil {
+		return p.las(addr, h)
+	}
+	conf, err := p.tlsConfig(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	ln, err := listen(addr)
+	if err != nil {
+		return err
+	}
+	h, svrs, err := p.listenExtra(h)
+	if err != nil {
+		ln.Close()
+		return err
+	}
+	svrs = append(svrs, server{&http.Server{Handler: p.track(h), TLSConfig: conf}, ln, true})
+	if opts := p.tlsOpts; opts != nil && opts.RedirectAddr != "" {
+		rln, err := listen(opts.RedirectAddr)
+		if err != nil {
+			closeListeners(svrs)
+			return err
+		}
+		debugPrint("Redirecting HTTP on %s to HTTPS\n", opts.RedirectAddr)
+		svr := &http.Server{Handler: redirectHTTPS(ln.Addr().String())}
+		svrs = append(svrs, server{svr, rln, false})
+	}
+	return p.serve(ctx, svrs...)
+}
+
+func (p *Engine) tlsConfig(certFile, keyFile string) (*tls.Config, error) {
+	cert, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	conf := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: cert.getCertificate,
+	}
+	if opts := p.tlsOpts; opts != nil {
+		if opts.MinVersion != 0 {
+			conf.MinVersion = opts.MinVersion
+		}
+		conf.CipherSuites = opts.CipherSuites
+		conf.ClientAuth = opts.ClientAuth
+		if opts.ClientCAFile == "" && opts.ClientAuth != tls.NoClientCert {
+			return nil, errClientCAFile
+		}
+		if opts.ClientCAFile != "" {
+			b, err := os.ReadFile(opts.ClientCAFile)
+			if err != nil {
+				return nil, err
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(b) {
+				return nil, errors.New("yap: no certificate found in " + opts.ClientCAFile)
+			}
+			conf.ClientCAs = pool
+			if conf.ClientAuth == tls.NoClientCert {
+				conf.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+		}
+	}
+	return conf, nil
+}
+
+var errClientCAFile = errors.New("yap: TLSOptions.ClientAuth is set without ClientCAFile")
+
+func redirectHTTPS(tlsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(tlsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		} else {
+			host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+		}
+		if port != "443" {
+			host = net.JoinHostPort(host, port)
+		} else if strings.IndexByte(host, ':') >= 0 {
+			host = "[" + host + "]"
+		}
+		code := http.StatusMovedPermanently
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			code = http.StatusPermanentRedirect
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), code)
+	})
+}
+
+// ClientCert returns the verified certificate of the client when mutual TLS
+// is enabled (see TLSOptions.ClientCAFile), or nil if there isn't.
+func (p *Context) ClientCert() *x509.Certificate {
+	if cs := p.Request.TLS; cs != nil && len(cs.PeerCertificates) > 0 {
+		return cs.PeerCertificates[0]
+	}
+	return nil
+}
+
+// -----------------------------------------------------------------------------
+
+const certCheckInterval = time.Second
+
+// certReloader loads a certificate and its private key, and reloads them if
+// files are changed. Files are checked at most once per certCheckInterval,
+// on TLS handshakes.
+type certReloader struct {
+	certFile, keyFile string
+
+	mutex   sync.Mutex
+	cert    *tls.Certificate
+	modtime time.Time // latest modtime of certFile and keyFile
+	checked time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	p := &certReloader{certFile: certFile, keyFile: keyFile}
+	modtime, err := p.modTime()
+	if err != nil {
+		return nil, err
+	}
+	if err = p.load(modtime); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *certReloader) modTime() (time.Time, error) {
+	fi, err := os.Stat(p.certFile)
+	if err != nil {
+		return time.Time{}, err
+	}
+	modtime := fi.ModTime()
+	if fi, err = os.Stat(p.keyFile); err != nil {
+		return time.Time{}, err
+	}
+	if t := fi.ModTime(); t.After(modtime) {
+		modtime = t
+	}
+	return modtime, nil
+}
+
+func (p *certReloader) load(modtime time.Time) error {
+	cert, err := tls.LoadX509KeyPair(p.certFile, p.keyFile)
+	if err != nil {
+		return err
+	}
+	p.cert, p.modtime, p.checked = &cert, modtime, time.Now()
+	return nil
+}
+
+func (p *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if now := time.Now(); now.Sub(p.checked) >= certCheckInterval {
+		p.checked = now
+		if modtime, err := p.modTime(); err != nil {
+			log.Println("yap: check certificate failed:", err)
+		} else if !modtime.Equal(p.modtime) {
+			if err = p.load(modtime); err != nil { // keep serving the old one
+				log.Println("yap: reload certificate failed:", err)
+			} else {
+				debugPrint("Certificate %s reloaded\n", p.certFile)
+			}
+		}
+	}
+	return p.cert, nil
+}
+
+// -----------------------------------------------------------------------------
+
+func (p *Engine) h2cHandler(svr *http.Server, h http.Handler) http.Handler {
+	h2s := &http2.Server{}
+	http2.ConfigureServer(svr, h2s) // to send GOAWAY on shutdown
+	return h2c.NewHandler(h, h2s)
+}
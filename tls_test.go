@@ -0,0 +1,282 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package yap
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// newTestCert creates a certificate of name signed by ca, or a self-signed CA
+// if ca is nil.
+func newTestCert(t *testing.T, name string, ca *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	parent, signer := tmpl, key
+	if ca == nil {
+		tmpl.IsCA, tmpl.BasicConstraintsValid = true, true
+		tmpl.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		parent, signer = ca.cert, ca.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCert{cert, key}
+}
+
+func (p *testCert) certPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: p.cert.Raw})
+}
+
+func (p *testCert) keyPEM() []byte {
+	b, _ := x509.MarshalECPrivateKey(p.key)
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: b})
+}
+
+func (p *testCert) tlsCert() tls.Certificate {
+	cert, _ := tls.X509KeyPair(p.certPEM(), p.keyPEM())
+	return cert
+}
+
+// writeFiles writes the certificate and its key to files in dir, with the
+// modification time modtime.
+func (p *testCert) writeFiles(t *testing.T, dir string, modtime time.Time) (certFile, keyFile string) {
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	for file, data := range map[string][]byte{certFile: p.certPEM(), keyFile: p.keyPEM()} {
+		if err := os.WriteFile(file, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(file, modtime, modtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca", nil)
+	old, renewed := newTestCert(t, "old.local", ca), newTestCert(t, "new.local", ca)
+	modtime := time.Now().Add(-time.Minute)
+	certFile, keyFile := old.writeFiles(t, dir, modtime)
+
+	p, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal("newCertReloader:", err)
+	}
+	name := func() string {
+		cert, err := p.getCertificate(nil)
+		if err != nil {
+			t.Fatal("getCertificate:", err)
+		}
+		x, _ := x509.ParseCertificate(cert.Certificate[0])
+		return x.Subject.CommonName
+	}
+	if cn := name(); cn != "old.local" {
+		t.Fatal("load:", cn)
+	}
+
+	renewed.writeFiles(t, dir, modtime.Add(time.Second))
+	if cn := name(); cn != "old.local" {
+		t.Fatal("checked within certCheckInterval:", cn)
+	}
+	p.checked = time.Time{}
+	if cn := name(); cn != "new.local" {
+		t.Fatal("reload:", cn)
+	}
+
+	os.WriteFile(keyFile, []byte("bad key"), 0600)
+	os.Chtimes(keyFile, modtime.Add(2*time.Second), modtime.Add(2*time.Second))
+	p.checked = time.Time{}
+	if cn := name(); cn != "new.local" {
+		t.Fatal("keep serving after reload failed:", cn)
+	}
+
+	if _, err = newCertReloader(filepath.Join(dir, "missing.pem"), keyFile); err == nil {
+		t.Fatal("newCertReloader: no error for a missing file")
+	}
+}
+
+func TestTLSClientCert(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca", nil)
+	certFile, keyFile := newTestCert(t, "yap.local", ca).writeFiles(t, dir, time.Now())
+	caFile := filepath.Join(dir, "ca.pem")
+	os.WriteFile(caFile, ca.certPEM(), 0600)
+
+	e := New()
+	e.GET("/whoami", func(ctx *Context) {
+		name := "anonymous"
+		if cert := ctx.ClientCert(); cert != nil {
+			name = cert.Subject.CommonName
+		}
+		ctx.TEXT(200, "text/plain", name)
+	})
+
+	e.SetTLSOptions(&TLSOptions{ClientAuth: tls.RequireAndVerifyClientCert})
+	if _, err := e.tlsConfig(certFile, keyFile); err != errClientCAFile {
+		t.Fatal("ClientAuth without ClientCAFile:", err)
+	}
+	e.SetTLSOptions(&TLSOptions{ClientCAFile: filepath.Join(dir, "missing.pem")})
+	if _, err := e.tlsConfig(certFile, keyFile); err == nil {
+		t.Fatal("missing ClientCAFile: no error")
+	}
+
+	e.SetTLSOptions(&TLSOptions{ClientCAFile: caFile})
+	sock := filepath.Join(dir, "app.sock")
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- e.RunTLSContext(ctx, "unix:"+sock, certFile, keyFile) }()
+	defer func() {
+		cancel()
+		if err := <-errc; err != nil {
+			t.Fatal("RunTLSContext:", err)
+		}
+	}()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	client := func(certs ...tls.Certificate) *http.Client {
+		c := unixClient(sock)
+		c.Transport.(*http.Transport).TLSClientConfig = &tls.Config{
+			RootCAs: roots, ServerName: "yap.local", Certificates: certs,
+		}
+		return c
+	}
+	c := client(newTestCert(t, "alice", ca).tlsCert())
+	waitServing(t, c, "https://yap.local/whoami")
+	resp, err := c.Get("https://yap.local/whoami")
+	if err != nil {
+		t.Fatal("GET:", err)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(b) != "alice" {
+		t.Fatal("ClientCert:", string(b))
+	}
+
+	if resp, err = client().Get("https://yap.local/whoami"); err == nil {
+		resp.Body.Close()
+		t.Fatal("served without a client certificate")
+	}
+	other := newTestCert(t, "other", nil)
+	if resp, err = client(newTestCert(t, "mallory", other).tlsCert()).Get("https://yap.local/whoami"); err == nil {
+		resp.Body.Close()
+		t.Fatal("served with an untrusted client certificate")
+	}
+}
+
+func TestRedirectHTTPS(t *testing.T) {
+	cases := []struct {
+		tlsAddr, method, url, loc string
+		code                      int
+	}{
+		{":443", "GET", "http://example.com/a?b=1", "https://example.com/a?b=1", 301},
+		{":443", "GET", "http://example.com:80/", "https://example.com/", 301},
+		{"[::]:8443", "HEAD", "http://example.com/a", "https://example.com:8443/a", 301},
+		{":443", "POST", "http://example.com/form", "https://example.com/form", 308},
+		{":443", "GET", "http://[::1]:80/", "https://[::1]/", 301},
+		{":8443", "GET", "http://[::1]/", "https://[::1]:8443/", 301},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		redirectHTTPS(c.tlsAddr).ServeHTTP(w, httptest.NewRequest(c.method, c.url, nil))
+		if w.Code != c.code || w.Header().Get("Location") != c.loc {
+			t.Fatal("redirectHTTPS:", c.tlsAddr, c.method, c.url, "=>", w.Code, w.Header().Get("Location"))
+		}
+	}
+}
+
+func TestH2C(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "app.sock")
+	e := New()
+	e.SetH2C(true)
+	e.GET("/proto", func(ctx *Context) {
+		ctx.TEXT(200, "text/plain", ctx.Proto)
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- e.RunContext(ctx, "unix:"+sock) }()
+	defer func() {
+		cancel()
+		if err := <-errc; err != nil {
+			t.Fatal("RunContext:", err)
+		}
+	}()
+
+	get := func(c *http.Client) string {
+		resp, err := c.Get("http://yap/proto")
+		if err != nil {
+			t.Fatal("GET:", err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return string(b)
+	}
+	c1 := unixClient(sock)
+	waitServing(t, c1, "http://yap/proto")
+	if proto := get(c1); proto != "HTTP/1.1" {
+		t.Fatal("HTTP/1.1:", proto)
+	}
+	c2 := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLS: func(_, _ string, _ *tls.Config) (net.Conn, error) {
+			return net.Dial("unix", sock)
+		},
+	}}
+	defer c2.CloseIdleConnections()
+	if proto := get(c2); proto != "HTTP/2.0" {
+		t.Fatal("h2c:", proto)
+	}
+}
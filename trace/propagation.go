@@ -0,0 +1,116 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package trace
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// W3C trace context headers.
+// See https://www.w3.org/TR/trace-context/ for more information.
+const (
+	HeaderTraceparent = "Traceparent"
+	HeaderTracestate  = "Tracestate"
+)
+
+// ParseTraceparent parses a W3C traceparent header value:
+//
+//	version "-" trace-id "-" parent-id "-" trace-flags
+//	00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+func ParseTraceparent(s string) (sc SpanContext, ok bool) {
+	s = strings.TrimSpace(s)
+	if len(s) < 55 || s[2] != '-' || s[35] != '-' || s[52] != '-' {
+		return
+	}
+	var ver [1]byte
+	if !decodeHex(ver[:], s[:2]) || ver[0] == 0xff {
+		return
+	}
+	if ver[0] == 0 && len(s) != 55 { // future versions may append fields
+		return
+	}
+	if len(s) > 55 && s[55] != '-' {
+		return
+	}
+	var flags [1]byte
+	if !decodeHex(sc.TraceID[:], s[3:35]) || !decodeHex(sc.SpanID[:], s[36:52]) ||
+		!decodeHex(flags[:], s[53:55]) {
+		return
+	}
+	if !sc.IsValid() {
+		return
+	}
+	sc.Flags = flags[0]
+	sc.Remote = true
+	return sc, true
+}
+
+func decodeHex(dst []byte, s string) bool {
+	for i := 0; i < len(s); i++ { // lowercase only
+		if c := s[i]; c >= 'A' && c <= 'F' {
+			return false
+		}
+	}
+	n, err := hex.Decode(dst, []byte(s))
+	return err == nil && n == len(dst)
+}
+
+// Traceparent formats sc as a W3C traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	var b [55]byte
+	b[0], b[1], b[2] = '0', '0', '-'
+	hex.Encode(b[3:35], sc.TraceID[:])
+	b[35] = '-'
+	hex.Encode(b[36:52], sc.SpanID[:])
+	b[52] = '-'
+	hex.Encode(b[53:55], []byte{sc.Flags})
+	return string(b[:])
+}
+
+// Extract returns a new context carrying the remote span context found in
+// traceparent/tracestate headers of h. It returns ctx itself if there is no
+// valid traceparent header.
+func Extract(ctx context.Context, h http.Header) context.Context {
+	tp := h.Get(HeaderTraceparent)
+	if tp == "" {
+		return ctx
+	}
+	sc, ok := ParseTraceparent(tp)
+	if !ok {
+		return ctx
+	}
+	sc.TraceState = strings.Join(h.Values(HeaderTracestate), ",")
+	return ContextWithRemoteSpanContext(ctx, sc)
+}
+
+// Inject sets traceparent/tracestate headers of h from the span context
+// carried by ctx, eg. before sending an outgoing request.
+func Inject(ctx context.Context, h http.Header) {
+	sc := SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+	h.Set(HeaderTraceparent, sc.Traceparent())
+	if sc.TraceState != "" {
+		h.Set(HeaderTracestate, sc.TraceState)
+	} else {
+		h.Del(HeaderTracestate)
+	}
+}
@@ -0,0 +1,201 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package trace is a minimal tracing abstraction used by yap and ydb.
+//
+// It doesn't depend on any tracing SDK. Adapt your favourite one (eg.
+// OpenTelemetry) by implementing the Tracer interface, or use NewTracer
+// with an Exporter.
+package trace
+
+import (
+	"context"
+	"encoding/hex"
+	"sync/atomic"
+)
+
+// -----------------------------------------------------------------------------
+
+// TraceID is a unique identity of a trace.
+type TraceID [16]byte
+
+// IsValid reports whether the trace id is not all zero.
+func (t TraceID) IsValid() bool {
+	return t != TraceID{}
+}
+
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+// SpanID is a unique identity of a span in a trace.
+type SpanID [8]byte
+
+// IsValid reports whether the span id is not all zero.
+func (s SpanID) IsValid() bool {
+	return s != SpanID{}
+}
+
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// FlagsSampled is the sampled bit of trace flags.
+const FlagsSampled = 0x01
+
+// SpanContext is the part of a span that is propagated across processes.
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Flags      byte   // trace flags, see FlagsSampled
+	TraceState string // vendor specific trace state (W3C tracestate)
+	Remote     bool   // extracted from an incoming request
+}
+
+// IsValid reports whether both trace id and span id are valid.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// IsSampled reports whether the sampled flag is set.
+func (sc SpanContext) IsSampled() bool {
+	return sc.Flags&FlagsSampled != 0
+}
+
+// -----------------------------------------------------------------------------
+
+// Span represents an operation within a trace.
+type Span interface {
+	// SpanContext returns the propagation data of this span.
+	SpanContext() SpanContext
+
+	// IsRecording reports whether this span records attributes and errors.
+	IsRecording() bool
+
+	// SetAttr sets an attribute of this span.
+	SetAttr(key string, value any)
+
+	// RecordError records an error and marks this span failed.
+	RecordError(err error)
+
+	// End completes this span.
+	End()
+}
+
+// Tracer creates spans.
+type Tracer interface {
+	// Start creates a span as a child of the span (or remote span context)
+	// carried by ctx, and returns a new context carrying the span.
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// -----------------------------------------------------------------------------
+
+type noopSpan struct {
+	sc SpanContext
+}
+
+func (p noopSpan) SpanContext() SpanContext { return p.sc }
+func (p noopSpan) IsRecording() bool        { return false }
+func (p noopSpan) SetAttr(string, any)      {}
+func (p noopSpan) RecordError(error)        {}
+func (p noopSpan) End()                     {}
+
+type noopTracer struct{}
+
+func (noopTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	return ctx, noopSpan{SpanContextFromContext(ctx)}
+}
+
+// Noop is a Tracer that does nothing.
+var Noop Tracer = noopTracer{}
+
+type tracerHolder struct {
+	Tracer
+}
+
+var defaultTracer atomic.Value // tracerHolder
+
+func init() {
+	defaultTracer.Store(tracerHolder{Noop})
+}
+
+// Default returns the global tracer (Noop by default).
+func Default() Tracer {
+	return defaultTracer.Load().(tracerHolder).Tracer
+}
+
+// SetDefault sets the global tracer. A nil tracer resets it to Noop.
+func SetDefault(t Tracer) {
+	if t == nil {
+		t = Noop
+	}
+	defaultTracer.Store(tracerHolder{t})
+}
+
+// -----------------------------------------------------------------------------
+
+type spanKey struct{}
+type remoteKey struct{}
+type tracerKey struct{}
+
+// ContextWithTracer returns a new context carrying t, eg. the tracer of the
+// server handling a request, so libraries start spans by the same tracer.
+func ContextWithTracer(ctx context.Context, t Tracer) context.Context {
+	return context.WithValue(ctx, tracerKey{}, t)
+}
+
+// FromContext returns the tracer carried by ctx, or Default() if there is no
+// tracer.
+func FromContext(ctx context.Context) Tracer {
+	if t, ok := ctx.Value(tracerKey{}).(Tracer); ok {
+		return t
+	}
+	return Default()
+}
+
+// ContextWithSpan returns a new context carrying span.
+func ContextWithSpan(ctx context.Context, span Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// ContextWithRemoteSpanContext returns a new context carrying a span context
+// extracted from an incoming request.
+func ContextWithRemoteSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	sc.Remote = true
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// SpanFromContext returns the span carried by ctx. If there is no span, a
+// non-recording span is returned.
+func SpanFromContext(ctx context.Context) Span {
+	if span, ok := ctx.Value(spanKey{}).(Span); ok {
+		return span
+	}
+	return noopSpan{SpanContextFromContext(ctx)}
+}
+
+// SpanContextFromContext returns the span context of the current span, or
+// the remote span context, carried by ctx.
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if span, ok := ctx.Value(spanKey{}).(Span); ok {
+		return span.SpanContext()
+	}
+	sc, _ := ctx.Value(remoteKey{}).(SpanContext)
+	return sc
+}
+
+// -----------------------------------------------------------------------------
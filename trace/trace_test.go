@@ -0,0 +1,130 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package trace
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+const tp = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestTraceparent(t *testing.T) {
+	sc, ok := ParseTraceparent(tp)
+	if !ok || !sc.IsSampled() || !sc.Remote {
+		t.Fatal("ParseTraceparent:", sc, ok)
+	}
+	if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" {
+		t.Fatal("ParseTraceparent:", sc.TraceID, sc.SpanID)
+	}
+	if ret := sc.Traceparent(); ret != tp {
+		t.Fatal("Traceparent:", ret)
+	}
+	for _, bad := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00_4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	} {
+		if _, ok := ParseTraceparent(bad); ok {
+			t.Fatal("ParseTraceparent should fail:", bad)
+		}
+	}
+	if _, ok := ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra"); !ok {
+		t.Fatal("ParseTraceparent: future version")
+	}
+}
+
+func TestTracer(t *testing.T) {
+	h := http.Header{}
+	h.Set(HeaderTraceparent, tp)
+	h.Set(HeaderTracestate, "foo=bar")
+	ctx := Extract(context.Background(), h)
+
+	exp := NewInMemoryExporter()
+	tr := NewTracer(exp)
+	ctx, parent := tr.Start(ctx, "parent")
+	_, child := tr.Start(ctx, "child")
+	child.SetAttr("k", 1)
+	child.SetAttr("k", 2)
+	child.RecordError(errors.New("failed"))
+	child.End()
+	child.End()
+	parent.End()
+
+	spans := exp.Spans()
+	if len(spans) != 2 {
+		t.Fatal("Spans:", len(spans))
+	}
+	c, p := exp.Span("child"), exp.Span("parent")
+	if c.SpanContext.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" ||
+		c.Parent.SpanID != p.SpanContext.SpanID || !p.Parent.Remote ||
+		c.SpanContext.TraceState != "foo=bar" {
+		t.Fatal("span tree:", c, p)
+	}
+	if v, ok := c.Attr("k"); !ok || v != 2 || c.Err == nil || len(c.Attrs) != 1 {
+		t.Fatal("span data:", c)
+	}
+
+	out := http.Header{}
+	Inject(ctx, out)
+	if sc, ok := ParseTraceparent(out.Get(HeaderTraceparent)); !ok || sc.SpanID != p.SpanContext.SpanID {
+		t.Fatal("Inject:", out)
+	}
+
+	h.Set(HeaderTraceparent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	_, span := tr.Start(Extract(context.Background(), h), "unsampled")
+	if span.IsRecording() {
+		t.Fatal("unsampled span is recording")
+	}
+	span.End()
+	if exp.Reset(); len(exp.Spans()) != 0 {
+		t.Fatal("Reset")
+	}
+}
+
+func TestNoop(t *testing.T) {
+	ctx := context.Background()
+	ret, span := Default().Start(ctx, "noop")
+	if ret != ctx || span.IsRecording() {
+		t.Fatal("Noop")
+	}
+	exp := NewInMemoryExporter()
+	SetDefault(NewTracer(exp))
+	defer SetDefault(nil)
+	_, span = Default().Start(ctx, "span")
+	span.End()
+	if exp.Span("span") == nil {
+		t.Fatal("SetDefault")
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	ctx := context.Background()
+	if FromContext(ctx) != Default() {
+		t.Fatal("FromContext: default")
+	}
+	tracer := NewTracer(NewInMemoryExporter())
+	if FromContext(ContextWithTracer(ctx, tracer)) != tracer {
+		t.Fatal("FromContext")
+	}
+}
@@ -0,0 +1,201 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"sync"
+	"time"
+)
+
+// -----------------------------------------------------------------------------
+
+// Attr is a key-value pair attached to a span.
+type Attr struct {
+	Key   string
+	Value any
+}
+
+// SpanData is a snapshot of a finished span.
+type SpanData struct {
+	Name        string
+	SpanContext SpanContext
+	Parent      SpanContext
+	Start       time.Time
+	End         time.Time
+	Attrs       []Attr
+	Err         error // the last error recorded
+}
+
+// Attr returns value of the attribute named key.
+func (p *SpanData) Attr(key string) (val any, ok bool) {
+	for _, a := range p.Attrs {
+		if a.Key == key {
+			return a.Value, true
+		}
+	}
+	return
+}
+
+// Exporter receives finished spans.
+type Exporter interface {
+	ExportSpan(data *SpanData)
+}
+
+// -----------------------------------------------------------------------------
+
+type tracer struct {
+	exp Exporter
+}
+
+// NewTracer creates a Tracer which exports finished spans to exp.
+//
+// Spans are sampled unless their parent is a remote or local span which is not
+// sampled.
+func NewTracer(exp Exporter) Tracer {
+	return &tracer{exp}
+}
+
+func (p *tracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	parent := SpanContextFromContext(ctx)
+	sc := SpanContext{Flags: FlagsSampled}
+	if parent.IsValid() {
+		sc.TraceID, sc.Flags, sc.TraceState = parent.TraceID, parent.Flags, parent.TraceState
+	} else {
+		rand.Read(sc.TraceID[:])
+	}
+	rand.Read(sc.SpanID[:])
+	if !sc.IsSampled() {
+		span := noopSpan{sc}
+		return ContextWithSpan(ctx, span), span
+	}
+	span := &span{
+		exp: p.exp,
+		data: SpanData{
+			Name:        name,
+			SpanContext: sc,
+			Parent:      parent,
+			Start:       time.Now(),
+		},
+	}
+	return ContextWithSpan(ctx, span), span
+}
+
+type span struct {
+	exp   Exporter
+	data  SpanData
+	mutex sync.Mutex
+	ended bool
+}
+
+func (p *span) SpanContext() SpanContext {
+	return p.data.SpanContext
+}
+
+func (p *span) IsRecording() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return !p.ended
+}
+
+func (p *span) SetAttr(key string, value any) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.ended {
+		return
+	}
+	for i, a := range p.data.Attrs {
+		if a.Key == key {
+			p.data.Attrs[i].Value = value
+			return
+		}
+	}
+	p.data.Attrs = append(p.data.Attrs, Attr{key, value})
+}
+
+func (p *span) RecordError(err error) {
+	if err == nil {
+		return
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if !p.ended {
+		p.data.Err = err
+	}
+}
+
+func (p *span) End() {
+	p.mutex.Lock()
+	if p.ended {
+		p.mutex.Unlock()
+		return
+	}
+	p.ended = true
+	p.data.End = time.Now()
+	data := p.data
+	p.mutex.Unlock()
+	p.exp.ExportSpan(&data)
+}
+
+// -----------------------------------------------------------------------------
+
+// InMemoryExporter keeps finished spans in memory. It is intended for tests.
+type InMemoryExporter struct {
+	spans []*SpanData
+	mutex sync.Mutex
+}
+
+// NewInMemoryExporter creates an InMemoryExporter.
+func NewInMemoryExporter() *InMemoryExporter {
+	return new(InMemoryExporter)
+}
+
+// ExportSpan implements Exporter.
+func (p *InMemoryExporter) ExportSpan(data *SpanData) {
+	p.mutex.Lock()
+	p.spans = append(p.spans, data)
+	p.mutex.Unlock()
+}
+
+// Spans returns finished spans in the order they ended.
+func (p *InMemoryExporter) Spans() []*SpanData {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return append([]*SpanData(nil), p.spans...)
+}
+
+// Span returns the first finished span named name.
+func (p *InMemoryExporter) Span(name string) *SpanData {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for _, s := range p.spans {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// Reset removes all finished spans.
+func (p *InMemoryExporter) Reset() {
+	p.mutex.Lock()
+	p.spans = nil
+	p.mutex.Unlock()
+}
+
+// -----------------------------------------------------------------------------
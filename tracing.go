@@ -0,0 +1,76 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package yap
+
+import (
+	"fmt"
+
+	"github.com/goplus/yap/trace"
+)
+
+// SetTracer sets the tracer used to trace route handlers and template
+// rendering. If it isn't set, trace.Default() is used.
+func (p *Engine) SetTracer(t trace.Tracer) {
+	p.tracer = t
+}
+
+// Tracer returns the tracer of this engine.
+func (p *Engine) Tracer() trace.Tracer {
+	if p.tracer != nil {
+		return p.tracer
+	}
+	return trace.Default()
+}
+
+// endSpan ends span. It records a panic as an error of the span, and then
+// panics again.
+func endSpan(span trace.Span) {
+	if e := recover(); e != nil {
+		if err, ok := e.(error); ok {
+			span.RecordError(err)
+		} else {
+			span.RecordError(fmt.Errorf("panic: %v", e))
+		}
+		span.End()
+		panic(e)
+	}
+	span.End()
+}
+
+func tracedHandle(method, path string, handle func(ctx *Context)) func(ctx *Context) {
+	name := method + " " + path
+	return func(ctx *Context) {
+		tracer := ctx.engine.Tracer()
+		c, span := tracer.Start(ctx.Request.Context(), name)
+		if ctx.engine.tracer != nil { // for libraries starting spans, see trace.FromContext
+			c = trace.ContextWithTracer(c, tracer)
+		}
+		if !span.IsRecording() {
+			if ctx.engine.tracer != nil {
+				ctx.Request = ctx.Request.WithContext(c)
+			}
+			handle(ctx)
+			return
+		}
+		defer endSpan(span)
+		ctx.Request = ctx.Request.WithContext(c)
+		span.SetAttr("http.method", method)
+		span.SetAttr("http.route", path)
+		span.SetAttr("http.target", ctx.URL.RequestURI())
+		handle(ctx)
+	}
+}
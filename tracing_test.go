@@ -0,0 +1,40 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package yap
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/goplus/yap/trace"
+)
+
+func TestTracerFromRequest(t *testing.T) {
+	exp := trace.NewInMemoryExporter()
+	e := New()
+	e.SetTracer(trace.NewTracer(exp))
+	e.GET("/users", func(ctx *Context) {
+		c := ctx.Context()
+		_, span := trace.FromContext(c).Start(c, "ydb.exec") // as a library does
+		span.End()
+	})
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users", nil))
+	req, sql := exp.Span("GET /users"), exp.Span("ydb.exec")
+	if req == nil || sql == nil || sql.Parent.SpanID != req.SpanContext.SpanID {
+		t.Fatal("spans:", exp.Spans())
+	}
+}
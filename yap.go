@@ -17,15 +17,18 @@
 package yap
 
 import (
+	"fmt"
 	"html/template"
 	"io/fs"
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 
 	"github.com/goplus/yap/noredirect"
+	"github.com/goplus/yap/trace"
 	_ "github.com/joho/godotenv/autoload"
 )
 
@@ -43,14 +46,28 @@ type Engine struct {
 	router
 	Mux *http.ServeMux
 
-	tpl             *Template
+	tpls            templates
 	fs              fs.FS
 	las             func(addr string, handler http.Handler) error
 	delims          Delims
 	tempaltePattern []string
+	tracer          trace.Tracer
+	graceful        graceful
+	tlsOpts         *TLSOptions
+	h2c             bool
+	listeners       []extraListener
+	health          healthz
+	cache           respCache
+	layout          string
+	funcs           template.FuncMap
+	fsDir           string // OS directory of fs, if any
+	md              mdCache
+	i18n            i18n
+	assets          []*assetManifest
+	staticOpts      map[string]*StaticOptions
 }
 
-// New creates a YAP engine.
+// New creates a YAP engine. See InitYap.
 func New(fs ...fs.FS) *Engine {
 	e := new(Engine)
 	e.InitYap(fs...)
@@ -58,59 +75,183 @@ func New(fs ...fs.FS) *Engine {
 	return e
 }
 
-// InitYap initialize a YAP application.
+// InitYap initialize a YAP application. $YapFS is fs[0], or its "yap"
+// subdirectory if there is.
+//
+// If fs[1] is specified, it's an on-disk override of an embedded fs[0], eg.
+// `yap.New(embedFS, yap.DirFS("."))`. It's used instead of fs[0] if it has
+// the "yap" directory (or any top-level file of fs[0] if fs[0] doesn't have
+// one), or if it exists in debug mode. So the same binary serves embedded
+// files in production and live files in development.
 func (p *Engine) InitYap(fs ...fs.FS) {
 	if p.Mux == nil {
 		p.Mux = http.NewServeMux()
-		p.las = http.ListenAndServe
 		p.router.init()
+		p.SetHealthPaths("/healthz", "/readyz")
 	}
-	if fs != nil {
+	switch len(fs) {
+	case 0:
+	case 1:
 		p.initYapFS(fs[0])
+	default:
+		p.initYapFS(selectYapFS(fs[0], fs[1]))
 	}
 }
 
+const yapDir = "yap"
+
+// selectYapFS returns disk if it overrides embedded, see InitYap.
+func selectYapFS(embedded, disk fs.FS) fs.FS {
+	if (IsDebugMode && isDir(disk, ".")) || hasYapFiles(embedded, disk) {
+		debugPrint("Serving $YapFS from disk")
+		return disk
+	}
+	return embedded
+}
+
+// hasYapFiles reports whether disk has the "yap" directory, or any top-level
+// file of embedded if embedded doesn't have one.
+func hasYapFiles(embedded, disk fs.FS) bool {
+	if isDir(disk, yapDir) {
+		return true
+	}
+	if isDir(embedded, yapDir) {
+		return false
+	}
+	entries, _ := fs.ReadDir(embedded, ".")
+	for _, e := range entries {
+		if _, err := fs.Stat(disk, e.Name()); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func isDir(fsys fs.FS, name string) bool {
+	fi, err := fs.Stat(fsys, name)
+	return err == nil && fi.IsDir()
+}
+
+// DirFS returns a file system of the directory dir like os.DirFS. In debug
+// mode, templates of $YapFS created by DirFS are reloaded when files of dir
+// change, while other file systems are polled for changes.
+func DirFS(dir string) fs.FS {
+	return &dirFS{os.DirFS(dir), dir}
+}
+
+// dirFS is a file system of an on-disk directory.
+type dirFS struct {
+	fs.FS
+	dir string
+}
+
 func (p *Engine) initYapFS(fsys fs.FS) {
-	const name = "yap"
+	const name = yapDir
+	var dir string
+	if d, ok := fsys.(*dirFS); ok {
+		dir = d.dir
+	}
 	if f, e := fsys.Open(name); e == nil {
 		f.Close()
 		if sub, e := fs.Sub(fsys, name); e == nil {
 			fsys = sub
+			if dir != "" {
+				dir = filepath.Join(dir, name)
+			}
 		}
 	}
-	p.fs = fsys
+	p.fs, p.fsDir = fsys, dir
 }
 
 // Load template
 func (p *Engine) LoadTemplate(pattern ...string) {
-	if len(pattern) == 0 {
-		pattern = append(pattern, "*_yap.html")
-	} else {
+	p.tpls.mutex.Lock()
+	defer p.tpls.mutex.Unlock()
+	if len(pattern) != 0 {
 		p.tempaltePattern = pattern
 	}
-	t, err := parseFS(NewTemplate(""), p.yapFS(), pattern)
+	t, err := p.parseTemplates(pattern)
 	if err != nil {
 		log.Panicln(err)
 	}
-	p.tpl = t
+	p.tpls.store(t)
 }
 
+func (p *Engine) parseTemplates(pattern []string) (*Template, error) {
+	if len(pattern) == 0 {
+		pattern = []string{"*_yap.html"}
+	}
+	t := NewTemplate("")
+	if p.delims.Left != "" {
+		t.delims = p.delims
+	}
+	t.Funcs(builtinFuncs).Funcs(p.engineFuncs()).Funcs(p.funcs)
+	fsys := p.yapFS()
+	text, err := p.parseTextTemplates(fsys, pattern, t.delims)
+	if err != nil {
+		return nil, err
+	}
+	files, err := globFiles(fsys, pattern, isHTMLFile)
+	if err != nil {
+		return nil, err
+	}
+	mdFiles, err := globFiles(fsys, derivePatterns(pattern, ".md"), isMarkdownFile)
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, mdFiles...)
+	if files == nil {
+		if text == nil {
+			return nil, fmt.Errorf("yap: patterns match no template files: %q", pattern)
+		}
+		err = t.lay.init(t)
+	} else {
+		t, err = parseFiles(t, p.readTemplateFile(fsys, t), files...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	t.text = text
+	return t, nil
+}
+
+func isHTMLFile(file string) bool {
+	return !isTextFile(file) && !isMarkdownFile(file)
+}
+
+// readTemplateFile returns a function to read HTML and Markdown templates.
+// Markdown templates are converted to HTML templates.
+func (p *Engine) readTemplateFile(fsys fs.FS, t *Template) func(string) (string, []byte, error) {
+	readFile := readFileFS(fsys)
+	return func(file string) (string, []byte, error) {
+		if !isMarkdownFile(file) {
+			return readFile(file)
+		}
+		src, err := p.readMarkdown(fsys, file, t.delims)
+		return markdownName(file), []byte(src), err
+	}
+}
+
+// SetDelims sets delimiters of YAP templates (default is {{ and }}), which
+// can be of any length, eg. [[[ and ]]]. A template file can override them by
+// a header directive like `<!-- yap:delims <% %> -->`.
 func (p *Engine) SetDelims(left, right string) {
-	if !(len(left) == 2 && len(right) == 2) {
-		log.Panicln("The length of the delimiter must be two")
+	if left == "" || right == "" {
+		log.Panicln("The delimiter must not be empty")
 	}
 	p.delims = Delims{left, right}
+	p.tpls.store((*Template)(nil))
 }
 
 func (p *Engine) yapFS() fs.FS {
 	if p.fs == nil {
-		p.initYapFS(os.DirFS("."))
+		p.initYapFS(DirFS("."))
 	}
 	return p.fs
 }
 
 func (p *Engine) NewContext(w http.ResponseWriter, r *http.Request) *Context {
-	ctx := &Context{ResponseWriter: w, Request: r, engine: p}
+	ctx := &Context{ResponseWriter: w, Request: r, engine: p, layout: p.layout}
 	return ctx
 }
 
@@ -135,7 +276,8 @@ func (p *Engine) Static(pattern string, dir ...fs.FS) {
 	p.StaticHttp(pattern, http.FS(fsys))
 }
 
-// StaticHttp serves static files from fsys (http.FileSystem).
+// StaticHttp serves static files from fsys (http.FileSystem). See
+// SetStaticOptions.
 func (p *Engine) StaticHttp(pattern string, fsys http.FileSystem, allowRedirect ...bool) {
 	if !strings.HasSuffix(pattern, "/") {
 		pattern += "/"
@@ -144,13 +286,11 @@ func (p *Engine) StaticHttp(pattern string, fsys http.FileSystem, allowRedirect
 	if allowRedirect != nil {
 		allow = allowRedirect[0]
 	}
-	var server http.Handler
-	if allow {
-		server = http.FileServer(fsys)
-	} else {
-		server = noredirect.FileServer(fsys)
+	newServer := http.FileServer
+	if !allow {
+		newServer = noredirect.FileServer
 	}
-	p.Mux.Handle(pattern, http.StripPrefix(pattern, server))
+	p.Mux.Handle(pattern, p.staticHandler(pattern, fsys, newServer))
 }
 
 // Handle registers the handler function for the given pattern.
@@ -169,30 +309,32 @@ func (p *Engine) Handler(mws ...func(h http.Handler) http.Handler) http.Handler
 	return h
 }
 
-// Run listens on the TCP network address addr and then calls
+// Run listens on the network address addr and then calls
 // Serve with handler to handle requests on incoming connections.
 // Accepted connections are configured to enable TCP keep-alives.
+//
+// The address addr can be:
+//   - unix:<path>: a unix domain socket, eg. "unix:/run/app.sock"
+//   - fd:<n>: an inherited file descriptor, eg. "fd:3"
+//   - systemd[:<name>]: a socket passed by systemd socket activation
+//   - otherwise: a TCP network address, eg. ":8080"
+//
+// Listeners added by Listen are served too.
+//
+// Run shuts down gracefully on SIGINT or SIGTERM. See RunContext.
 func (p *Engine) Run(addr string, mws ...func(h http.Handler) http.Handler) error {
-	h := p.Handler(mws...)
-
-	debugPrint("Listening and serving HTTP on %s\n", addr)
-
-	return p.las(addr, h)
+	ctx, stop := signalContext()
+	defer stop()
+	return p.RunContext(ctx, addr, mws...)
 }
 
 // SetLAS sets listenAndServe func to listens on the TCP network address addr
 // and to handle requests on incoming connections.
+// Graceful shutdown isn't available if listenAndServe func is customized.
 func (p *Engine) SetLAS(listenAndServe func(addr string, handler http.Handler) error) {
 	p.las = listenAndServe
 }
 
-func (p *Engine) templ(path string) *template.Template {
-	if p.tpl == nil || IsDebugMode {
-		p.LoadTemplate(p.tempaltePattern...)
-	}
-	return p.tpl.Lookup(path)
-}
-
 // SubFS returns a sub filesystem by specified a dir.
 func SubFS(fsys fs.FS, dir string) (ret fs.FS) {
 	f, err := fsys.Open(dir)
@@ -0,0 +1,61 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package yap
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestDiskOverride(t *testing.T) {
+	embedded := fstest.MapFS{
+		"yap/hello_yap.html": {Data: []byte("embedded")},
+	}
+	render := func(e *Engine) string {
+		s, err := e.RenderString("hello", nil)
+		if err != nil {
+			t.Fatal("RenderString:", err)
+		}
+		return s
+	}
+
+	dir := t.TempDir()
+	if s := render(New(embedded, DirFS(dir))); s != "embedded" {
+		t.Fatal("no override:", s)
+	}
+
+	if err := os.Mkdir(filepath.Join(dir, "yap"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "yap", "hello_yap.html"), []byte("disk"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	e := New(embedded, DirFS(dir))
+	if s := render(e); s != "disk" || e.fsDir != filepath.Join(dir, "yap") {
+		t.Fatal("override:", s, e.fsDir)
+	}
+
+	flat := fstest.MapFS{"hello_yap.html": {Data: []byte("flat")}}
+	if s := render(New(flat, DirFS(t.TempDir()))); s != "flat" {
+		t.Fatal("flat no override:", s)
+	}
+	if s := render(New(flat, DirFS(filepath.Join(dir, "yap")))); s != "disk" {
+		t.Fatal("flat override:", s)
+	}
+}
@@ -25,6 +25,7 @@ import (
 	"strings"
 
 	"github.com/goplus/gop/ast"
+	"github.com/goplus/yap/trace"
 )
 
 var (
@@ -47,6 +48,8 @@ type Class struct {
 	result []reflect.Value // result of an api call
 
 	ret func(args ...any)
+
+	ctx context.Context // see WithContext
 }
 
 func newClass(name string, sql *Sql) *Class {
@@ -64,6 +67,55 @@ func newClass(name string, sql *Sql) *Class {
 func (p *Class) gen(ctx context.Context) {
 }
 
+// WithContext returns a copy of the class whose sql operations use ctx, eg.
+// the context of a HTTP request so queries are cancelled with the request or
+// by its route timeout (see yap.Timeout):
+//
+//	cls.WithContext(ctx.Context()).Count(...)
+//
+// Without it, sql operations use context.Background() and aren't cancelled.
+func (p *Class) WithContext(ctx context.Context) *Class {
+	ret := *p
+	ret.ctx = ctx
+	return &ret
+}
+
+func (p *Class) context() context.Context {
+	if p.ctx != nil {
+		return p.ctx
+	}
+	return context.Background()
+}
+
+// startSpan starts a span of a sql statement as a child of the span of ctx,
+// by the tracer carried by ctx (see yap.Engine.SetTracer), or the default
+// tracer (see trace.SetDefault).
+func (p *Class) startSpan(ctx context.Context, op, query string) (context.Context, trace.Span) {
+	ctx, span := trace.FromContext(ctx).Start(ctx, "ydb."+op)
+	if span.IsRecording() {
+		span.SetAttr("db.system", p.sql.driver)
+		span.SetAttr("db.statement", query)
+		span.SetAttr("ydb.class", p.name)
+	}
+	return ctx, span
+}
+
+func (p *Class) exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	ctx, span := p.startSpan(ctx, "exec", query)
+	defer span.End()
+	result, err := p.db.ExecContext(ctx, query, args...)
+	span.RecordError(err)
+	return result, err
+}
+
+func (p *Class) queryRow(ctx context.Context, query string, args ...any) *sql.Row {
+	ctx, span := p.startSpan(ctx, "queryRow", query)
+	defer span.End()
+	row := p.db.QueryRowContext(ctx, query, args...)
+	span.RecordError(row.Err())
+	return row
+}
+
 // Use sets the default table used in following sql operations.
 func (p *Class) Use(table string, src ...ast.Node) {
 	tblobj, ok := p.sql.tables[table]
@@ -233,7 +285,7 @@ func (p *Class) insertRowsVals(names []string, vals []any, rows int) {
 	query := insertQuery(p.tbl, names)
 	query = append(query, valParams(n, rows)...)
 
-	result, err := p.db.ExecContext(context.TODO(), string(query), vals...)
+	result, err := p.exec(p.context(), string(query), vals...)
 	insertRet(result, err)
 }
 
@@ -243,7 +295,7 @@ func (p *Class) insertRow(names []string, vals []any) {
 	}
 	query := insertQuery(p.tbl, names)
 	query = append(query, valParam(len(vals))...)
-	result, err := p.db.ExecContext(context.TODO(), string(query), vals...)
+	result, err := p.exec(p.context(), string(query), vals...)
 	insertRet(result, err)
 }
 
@@ -286,7 +338,7 @@ func (p *Class) Count__0(src ast.Node, cond string, args ...any) (n int) {
 	if p.tbl == "" {
 		log.Panicln("please call `use <tableName>` to specified a table name")
 	}
-	row := p.db.QueryRowContext(context.TODO(), "SELECT COUNT(*) FROM "+p.tbl+" WHERE "+cond, args...)
+	row := p.queryRow(p.context(), "SELECT COUNT(*) FROM "+p.tbl+" WHERE "+cond, args...)
 	if err := row.Scan(&n); err != nil {
 		log.Panicln("count:", err)
 	}
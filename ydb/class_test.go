@@ -0,0 +1,83 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ydb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goplus/yap"
+)
+
+// blockDriver is a sql driver whose queries block until they are cancelled.
+type blockDriver struct{}
+
+func (blockDriver) Open(string) (driver.Conn, error) { return blockConn{}, nil }
+
+type blockConn struct{}
+
+func (blockConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (blockConn) Close() error                        { return nil }
+func (blockConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (blockConn) QueryContext(ctx context.Context, _ string, _ []driver.NamedValue) (driver.Rows, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func init() {
+	sql.Register("ydbtest.block", blockDriver{})
+}
+
+func TestClassTimeout(t *testing.T) {
+	db, err := sql.Open("ydbtest.block", "")
+	if err != nil {
+		t.Fatal("sql.Open:", err)
+	}
+	defer db.Close()
+	cls := &Class{name: "user", tbl: "user", sql: &Sql{driver: "ydbtest.block", db: db}, db: db}
+
+	queryErr := make(chan string, 1)
+	e := yap.New()
+	e.GET("/users", func(ctx *yap.Context) {
+		defer func() {
+			queryErr <- fmt.Sprint(recover())
+		}()
+		cls.WithContext(ctx.Context()).Count__1("id=?", 1)
+	}, yap.Timeout(20*time.Millisecond))
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest("GET", "/users", nil))
+	if w.Code != 503 {
+		t.Fatal("timeout:", w.Code)
+	}
+	select {
+	case s := <-queryErr:
+		if !strings.Contains(s, context.DeadlineExceeded.Error()) {
+			t.Fatal("query isn't cancelled:", s)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("query isn't cancelled")
+	}
+}
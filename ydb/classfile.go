@@ -21,9 +21,11 @@ import (
 	"database/sql"
 	"log"
 	"reflect"
+	"strconv"
 	"strings"
 
 	"github.com/goplus/gop/ast"
+	"github.com/goplus/yap/health"
 )
 
 const (
@@ -37,6 +39,7 @@ type dbClass = Class
 
 type Sql struct {
 	driver  string
+	name    string
 	tables  map[string]*Table
 	classes map[string]*Class
 	db      *sql.DB
@@ -58,6 +61,7 @@ func (p *Sql) Engine__0(name string, src ...ast.Node) {
 		}
 		p.db = db
 		p.driver = name
+		p.register()
 	}
 }
 
@@ -66,6 +70,49 @@ func (p *Sql) Engine__1() string {
 	return p.driver
 }
 
+// Name sets name of the database, which names its readiness check
+// "ydb.<name>". Default is the engine name, suffixed by "#2", "#3", etc. if
+// there are other databases of the same engine. For example:
+//
+//	engine "mysql"
+//	name "orders"
+func (p *Sql) Name__0(name string) {
+	if p.db != nil {
+		health.Unregister("ydb." + p.name)
+		p.name = name
+		p.register()
+	} else {
+		p.name = name
+	}
+}
+
+// Name returns name of the database.
+func (p *Sql) Name__1() string {
+	return p.name
+}
+
+// register registers the readiness check of the database.
+func (p *Sql) register() {
+	if p.name == "" {
+		checks := health.All()
+		name := p.driver
+		for i := 2; checks["ydb."+name].Check != nil; i++ {
+			name = p.driver + "#" + strconv.Itoa(i)
+		}
+		p.name = name
+	}
+	health.Register("ydb."+p.name, p.db.PingContext)
+}
+
+// Close closes the database, eg. in a yap `onShutdown` hook.
+func (p *Sql) Close() error {
+	if p.db == nil {
+		return nil
+	}
+	health.Unregister("ydb." + p.name)
+	return p.db.Close()
+}
+
 func (p *Sql) defineTable(nameVer string, zeroSchema any) {
 	var name, ver string
 	pos := strings.IndexByte(nameVer, ' ') // user v0.1.0
@@ -84,7 +131,7 @@ func (p *Sql) defineTable(nameVer string, zeroSchema any) {
 	tbl := newTable(name, ver, schema)
 	p.dbTable = tbl
 	p.tables[name] = tbl
-	tbl.create(context.TODO(), p)
+	tbl.create(context.Background(), p)
 }
 
 func dbName(fldName string) string {
@@ -113,7 +160,7 @@ func (p *Sql) Class(name string, spec func(), src ...ast.Node) {
 	p.dbClass = cls
 	p.classes[name] = cls
 	spec()
-	cls.gen(context.TODO())
+	cls.gen(context.Background())
 	p.dbClass = nil
 }
 